@@ -3,6 +3,7 @@ module github.com/JGrinovich/bpm-runner-app/backend
 go 1.24.5
 
 require (
+	github.com/JGrinovich/bpm-runner-app/shared v0.0.0
 	github.com/aws/aws-sdk-go-v2 v1.41.1
 	github.com/aws/aws-sdk-go-v2/config v1.32.7
 	github.com/aws/aws-sdk-go-v2/credentials v1.19.7
@@ -51,3 +52,5 @@ require (
 	golang.org/x/sys v0.40.0 // indirect
 	golang.org/x/text v0.33.0 // indirect
 )
+
+replace github.com/JGrinovich/bpm-runner-app/shared => ../shared
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// analysisFrom is the FROM clause analysisCols expects: the run (a) and its
+// track (t), so the result can say whether the run is the current one.
+const analysisFrom = `track_analysis a JOIN tracks t ON t.id = a.track_id`
+
+// analysisCols is the column list scanAnalysis expects, in order.
+const analysisCols = `a.id, a.track_id, a.bpm, a.confidence, a.status, a.error_message, a.created_at, a.finished_at,
+	COALESCE(a.id = t.current_analysis_id, false), a.algorithm, a.algorithm_version, a.params, a.raw_candidates, a.tempo_candidates,
+	a.time_signature, a.beats_per_bar, a.meter_confidence,
+	a.key_tonic, a.key_mode, a.key_camelot, a.key_confidence,
+	a.loudness_lufs, a.loudness_range_lu, a.true_peak_dbtp, a.energy, a.energy_curve,
+	a.duration_sec, a.intro_end_sec, a.outro_start_sec, a.silences,
+	a.runnability, a.runnability_detail`
+
+type analysisRow struct {
+	ID         string
+	TrackID    string
+	Bpm        *float64
+	Confidence *float64
+	Status     string
+	ErrMsg     *string
+	Created    time.Time
+	Finished   *time.Time
+
+	IsCurrent        bool
+	Algorithm        *string
+	AlgorithmVersion *string
+	Params           json.RawMessage
+	RawCandidates    json.RawMessage
+	TempoCandidates  json.RawMessage
+
+	TimeSignature   *string
+	BeatsPerBar     *int
+	MeterConfidence *float64
+
+	KeyTonic      *string
+	KeyMode       *string
+	KeyCamelot    *string
+	KeyConfidence *float64
+
+	LoudnessLUFS *float64
+	LoudnessLRA  *float64
+	TruePeak     *float64
+	Energy       *float64
+	EnergyCurve  []float32
+
+	DurationSec   *float64
+	IntroEndSec   *float64
+	OutroStartSec *float64
+	Silences      json.RawMessage
+
+	Runnability       *float64
+	RunnabilityDetail json.RawMessage
+}
+
+func scanAnalysis(row pgx.Row) (*analysisRow, error) {
+	var a analysisRow
+	err := row.Scan(&a.ID, &a.TrackID, &a.Bpm, &a.Confidence, &a.Status, &a.ErrMsg, &a.Created, &a.Finished,
+		&a.IsCurrent, &a.Algorithm, &a.AlgorithmVersion, &a.Params, &a.RawCandidates, &a.TempoCandidates,
+		&a.TimeSignature, &a.BeatsPerBar, &a.MeterConfidence,
+		&a.KeyTonic, &a.KeyMode, &a.KeyCamelot, &a.KeyConfidence,
+		&a.LoudnessLUFS, &a.LoudnessLRA, &a.TruePeak, &a.Energy, &a.EnergyCurve,
+		&a.DurationSec, &a.IntroEndSec, &a.OutroStartSec, &a.Silences,
+		&a.Runnability, &a.RunnabilityDetail)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (a *analysisRow) response() map[string]any {
+	m := map[string]any{
+		"id":                a.ID,
+		"track_id":          a.TrackID,
+		"bpm":               a.Bpm,
+		"confidence":        a.Confidence,
+		"status":            a.Status,
+		"error":             a.ErrMsg,
+		"created_at":        a.Created.Format(time.RFC3339),
+		"is_current":        a.IsCurrent,
+		"algorithm":         a.Algorithm,
+		"algorithm_version": a.AlgorithmVersion,
+		"params":            a.Params,
+		"raw_candidates":    a.RawCandidates,
+		"tempo_candidates":  a.TempoCandidates,
+		"time_signature":    a.TimeSignature,
+		"beats_per_bar":     a.BeatsPerBar,
+		"meter_confidence":  a.MeterConfidence,
+		// 3/4 and 6/8 songs don't line up with a two-step running cadence
+		"triple_meter":   a.BeatsPerBar != nil && *a.BeatsPerBar%3 == 0,
+		"key":            nil,
+		"key_confidence": a.KeyConfidence,
+		"camelot":        a.KeyCamelot,
+		"loudness": map[string]any{
+			"integrated_lufs": a.LoudnessLUFS,
+			"range_lu":        a.LoudnessLRA,
+			"true_peak_dbtp":  a.TruePeak,
+		},
+		"energy":                  a.Energy,
+		"energy_curve":            a.EnergyCurve,
+		"energy_curve_window_sec": 10,
+		"duration_sec":            a.DurationSec,
+		"intro_end_sec":           a.IntroEndSec,
+		"outro_start_sec":         a.OutroStartSec,
+		"silences":                a.Silences,
+		"runnability":             a.Runnability,
+		"runnability_detail":      a.RunnabilityDetail,
+	}
+	if a.KeyTonic != nil && a.KeyMode != nil {
+		m["key"] = map[string]string{
+			"tonic": *a.KeyTonic,
+			"mode":  *a.KeyMode,
+			"name":  *a.KeyTonic + " " + *a.KeyMode,
+		}
+	}
+	if a.Finished != nil {
+		m["finished_at"] = a.Finished.Format(time.RFC3339)
+	}
+	return m
+}
+
+// handleListAnalyses lists every analysis run for the track, newest first.
+func (s *Server) handleListAnalyses(w http.ResponseWriter, r *http.Request, userID, trackID string) {
+	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := s.DB.Query(r.Context(),
+		`SELECT `+analysisCols+` FROM `+analysisFrom+`
+		 WHERE a.track_id=$1
+		 ORDER BY a.created_at DESC`,
+		trackID,
+	)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := []map[string]any{}
+	for rows.Next() {
+		a, err := scanAnalysis(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, a.response())
+	}
+	if rows.Err() != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleSetCurrentAnalysis points the track at an earlier (finished) run,
+// e.g. to roll back after a bad algorithm change.
+func (s *Server) handleSetCurrentAnalysis(w http.ResponseWriter, r *http.Request, userID, trackID, analysisID string) {
+	if _, err := uuid.Parse(analysisID); err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var status string
+	err := s.DB.QueryRow(r.Context(),
+		`SELECT status FROM track_analysis WHERE id=$1 AND track_id=$2`,
+		analysisID, trackID,
+	).Scan(&status)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if status != "done" {
+		http.Error(w, "only finished analyses can be made current", http.StatusConflict)
+		return
+	}
+
+	if _, err := s.DB.Exec(r.Context(),
+		`UPDATE tracks SET current_analysis_id=$1 WHERE id=$2`,
+		analysisID, trackID,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"track_id": trackID, "current_analysis_id": analysisID})
+}
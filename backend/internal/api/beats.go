@@ -0,0 +1,111 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+)
+
+type BeatsResponse struct {
+	TrackID    string    `json:"track_id"`
+	AnalysisID string    `json:"analysis_id"`
+	Bpm        *float64  `json:"bpm"`
+	From       *float64  `json:"from,omitempty"`
+	To         *float64  `json:"to,omitempty"`
+	Count      int       `json:"count"`
+	Beats      []float32 `json:"beats"`
+
+	TimeSignature *string   `json:"time_signature"`
+	BeatsPerBar   *int      `json:"beats_per_bar"`
+	Bars          []float32 `json:"bars"`
+}
+
+// handleGetBeats serves the stored beat grid (and bar starts, when the meter
+// was detected), optionally limited to the [from, to) range given in seconds.
+func (s *Server) handleGetBeats(w http.ResponseWriter, r *http.Request, userID, trackID string) {
+	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	from, err := parseOptionalSeconds(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseOptionalSeconds(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if from != nil && to != nil && *to < *from {
+		http.Error(w, "to must be >= from", http.StatusBadRequest)
+		return
+	}
+
+	var id string
+	var bpm *float64
+	var status string
+	var beats, bars []float32
+	var timeSig *string
+	var beatsPerBar *int
+	err = s.DB.QueryRow(r.Context(),
+		`SELECT a.id, a.bpm, a.status, a.beat_times, a.bar_times, a.time_signature, a.beats_per_bar
+		 FROM tracks t
+		 JOIN track_analysis a ON a.id = t.current_analysis_id
+		 WHERE t.id=$1`,
+		trackID,
+	).Scan(&id, &bpm, &status, &beats, &bars, &timeSig, &beatsPerBar)
+	if err != nil {
+		http.Error(w, "no analysis", http.StatusNotFound)
+		return
+	}
+	if status != "done" {
+		http.Error(w, "analysis not ready", http.StatusConflict)
+		return
+	}
+	if beats == nil {
+		http.Error(w, "no beat grid for this analysis (re-run analysis)", http.StatusNotFound)
+		return
+	}
+
+	out := timesInRange(beats, from, to)
+	writeJSON(w, http.StatusOK, BeatsResponse{
+		TrackID:       trackID,
+		AnalysisID:    id,
+		Bpm:           bpm,
+		From:          from,
+		To:            to,
+		Count:         len(out),
+		Beats:         out,
+		TimeSignature: timeSig,
+		BeatsPerBar:   beatsPerBar,
+		Bars:          timesInRange(bars, from, to),
+	})
+}
+
+func timesInRange(times []float32, from, to *float64) []float32 {
+	out := make([]float32, 0, len(times))
+	for _, v := range times {
+		t := float64(v)
+		if from != nil && t < *from {
+			continue
+		}
+		if to != nil && t >= *to {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func parseOptionalSeconds(v string) (*float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return nil, strconv.ErrSyntax
+	}
+	return &f, nil
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/tempo"
+)
+
+type SetBpmRequest struct {
+	Bpm           float64  `json:"bpm"`
+	BeatOffsetSec *float64 `json:"beat_offset_sec"`
+}
+
+type TapTempoRequest struct {
+	// Playback positions (seconds into the track) at which the user tapped
+	TapTimes []float64 `json:"tap_times"`
+}
+
+type BpmOverrideResponse struct {
+	TrackID       string   `json:"track_id"`
+	Bpm           float64  `json:"bpm"`
+	BeatOffsetSec *float64 `json:"beat_offset_sec"`
+	Source        string   `json:"source"`
+	Confidence    *float64 `json:"confidence,omitempty"`
+}
+
+// handleBpmOverride sets (PUT) or clears (DELETE) the user-confirmed BPM.
+func (s *Server) handleBpmOverride(w http.ResponseWriter, r *http.Request, userID, trackID string) {
+	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		_, err := s.DB.Exec(r.Context(),
+			`UPDATE tracks
+			 SET bpm_override=NULL, bpm_override_offset_sec=NULL, bpm_override_source=NULL,
+			     bpm_override_confidence=NULL, bpm_override_at=NULL
+			 WHERE id=$1`,
+			trackID,
+		)
+		if err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req SetBpmRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Bpm < 40 || req.Bpm > 260 {
+		http.Error(w, "bpm out of range", http.StatusBadRequest)
+		return
+	}
+	if req.BeatOffsetSec != nil && (*req.BeatOffsetSec < 0 || *req.BeatOffsetSec >= 60/req.Bpm) {
+		http.Error(w, "beat_offset_sec must be within one beat", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.saveBpmOverride(r, trackID, req.Bpm, req.BeatOffsetSec, "manual", nil); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, BpmOverrideResponse{
+		TrackID:       trackID,
+		Bpm:           req.Bpm,
+		BeatOffsetSec: req.BeatOffsetSec,
+		Source:        "manual",
+	})
+}
+
+// handleTapTempo turns a list of taps into a BPM override, using the same
+// interval math as the analysis.
+func (s *Server) handleTapTempo(w http.ResponseWriter, r *http.Request, userID, trackID string) {
+	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var req TapTempoRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	for i, t := range req.TapTimes {
+		if t < 0 || (i > 0 && t <= req.TapTimes[i-1]) {
+			http.Error(w, "tap_times must be increasing and non-negative", http.StatusBadRequest)
+			return
+		}
+	}
+
+	bpm, conf, ok := tempo.BPMAndConfidenceFromBeats(req.TapTimes)
+	if !ok {
+		http.Error(w, "need at least 8 steady taps", http.StatusBadRequest)
+		return
+	}
+	if bpm < 40 || bpm > 260 {
+		http.Error(w, "tapped bpm out of range", http.StatusBadRequest)
+		return
+	}
+	bpm = math.Round(bpm*100) / 100
+	offset := tempo.BeatOffset(req.TapTimes, bpm)
+
+	if err := s.saveBpmOverride(r, trackID, bpm, &offset, "tap", &conf); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, BpmOverrideResponse{
+		TrackID:       trackID,
+		Bpm:           bpm,
+		BeatOffsetSec: &offset,
+		Source:        "tap",
+		Confidence:    &conf,
+	})
+}
+
+func (s *Server) saveBpmOverride(r *http.Request, trackID string, bpm float64, offset *float64, source string, conf *float64) error {
+	_, err := s.DB.Exec(r.Context(),
+		`UPDATE tracks
+		 SET bpm_override=$1, bpm_override_offset_sec=$2, bpm_override_source=$3,
+		     bpm_override_confidence=$4, bpm_override_at=now()
+		 WHERE id=$5`,
+		bpm, offset, source, conf, trackID,
+	)
+	return err
+}
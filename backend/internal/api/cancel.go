@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Jobs can be canceled until they finish. A running job keeps going until
+// the worker next checks its status (a couple of seconds), then stops and
+// removes anything it uploaded.
+
+// handleCancelAnalysis cancels an analysis run. Renders waiting on it fail,
+// as they would if it had failed.
+func (s *Server) handleCancelAnalysis(w http.ResponseWriter, r *http.Request, userID, trackID, analysisID string) {
+	if _, err := uuid.Parse(analysisID); err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := s.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback(r.Context()) }()
+
+	var status string
+	err = tx.QueryRow(r.Context(),
+		`SELECT status FROM track_analysis WHERE id=$1 AND track_id=$2 FOR UPDATE`,
+		analysisID, trackID,
+	).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	if status != "queued" && status != "running" {
+		http.Error(w, "analysis already "+status, http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec(r.Context(),
+		`UPDATE track_analysis SET status='canceled', finished_at=now() WHERE id=$1`,
+		analysisID,
+	); err != nil {
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(r.Context(),
+		`UPDATE render_jobs
+		 SET status='failed', error_message='analysis canceled', finished_at=now()
+		 WHERE depends_on_analysis_id=$1 AND status='waiting'`,
+		analysisID,
+	); err != nil {
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": analysisID, "status": "canceled"})
+}
+
+// handleCancelRender cancels a waiting, queued or running render.
+func (s *Server) handleCancelRender(w http.ResponseWriter, r *http.Request, userID, renderID string) {
+	var status string
+	err := s.DB.QueryRow(r.Context(),
+		`SELECT r.status
+		 FROM render_jobs r
+		 JOIN tracks t ON t.id = r.track_id
+		 WHERE r.id=$1 AND t.user_id=$2`,
+		renderID, userID,
+	).Scan(&status)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tag, err := s.DB.Exec(r.Context(),
+		`UPDATE render_jobs
+		 SET status='canceled', finished_at=now()
+		 WHERE id=$1 AND status IN ('waiting','queued','running')`,
+		renderID,
+	)
+	if err != nil {
+		http.Error(w, "cancel failed", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		// Finished between the two queries, or before the request
+		if err := s.DB.QueryRow(r.Context(), `SELECT status FROM render_jobs WHERE id=$1`, renderID).Scan(&status); err != nil {
+			http.Error(w, "cancel failed", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "render already "+status, http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": renderID, "status": "canceled"})
+}
@@ -2,14 +2,21 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/JGrinovich/bpm-runner-app/backend/internal/auth"
 	"github.com/JGrinovich/bpm-runner-app/backend/internal/storage"
+	"github.com/JGrinovich/bpm-runner-app/shared/audioformat"
+	"github.com/JGrinovich/bpm-runner-app/shared/rendercache"
+	"github.com/JGrinovich/bpm-runner-app/shared/stretch"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -36,6 +43,7 @@ func (s *Server) Routes() http.Handler {
 
 	// Protected (wrap individual handlers)
 	mux.Handle("/api/me", AuthMiddleware(s.JWTSecret, http.HandlerFunc(s.handleMe)))
+	mux.Handle("/api/me/settings", AuthMiddleware(s.JWTSecret, http.HandlerFunc(s.handleSettings)))
 	mux.Handle("/api/tracks", AuthMiddleware(s.JWTSecret, http.HandlerFunc(s.handleTracks)))
 	mux.Handle("/api/tracks/", AuthMiddleware(s.JWTSecret, http.HandlerFunc(s.handleTrackByID)))
 	mux.Handle("/api/renders/", AuthMiddleware(s.JWTSecret, http.HandlerFunc(s.handleRenderByID)))
@@ -158,8 +166,17 @@ func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// The track and (per the user's settings) its first analysis run go in
+		// together, so a track never exists without a way to get a BPM.
+		tx, err := s.DB.Begin(r.Context())
+		if err != nil {
+			http.Error(w, "insert failed", http.StatusInternalServerError)
+			return
+		}
+		defer func() { _ = tx.Rollback(r.Context()) }()
+
 		var trackID string
-		err := s.DB.QueryRow(r.Context(),
+		err = tx.QueryRow(r.Context(),
 			`INSERT INTO tracks (user_id, title, source_filename, mime_type, duration_sec, original_object_key)
 			 VALUES ($1,$2,$3,$4,$5,$6)
 			 RETURNING id`,
@@ -169,13 +186,70 @@ func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "insert failed", http.StatusInternalServerError)
 			return
 		}
-		writeJSON(w, http.StatusCreated, map[string]string{"id": trackID})
+
+		settings, err := userSettings(r.Context(), tx, userID)
+		if err != nil {
+			http.Error(w, "insert failed", http.StatusInternalServerError)
+			return
+		}
+		var analysisID *string
+		if settings.AutoAnalyze {
+			// The analysis job also ingests the file's metadata (codec, sample rate, tags)
+			var id string
+			if err := tx.QueryRow(r.Context(),
+				`INSERT INTO track_analysis (track_id, status)
+				 VALUES ($1,'queued')
+				 RETURNING id`,
+				trackID,
+			).Scan(&id); err != nil {
+				http.Error(w, "enqueue failed", http.StatusInternalServerError)
+				return
+			}
+			analysisID = &id
+		}
+
+		if err := tx.Commit(r.Context()); err != nil {
+			http.Error(w, "insert failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"id": trackID, "analysis_id": analysisID})
 
 	case http.MethodGet:
+		// ?sort=created_at|bpm|energy|runnability&order=asc|desc
+		sortExpr, ok := trackSortColumns[r.URL.Query().Get("sort")]
+		if !ok {
+			http.Error(w, "invalid sort", http.StatusBadRequest)
+			return
+		}
+		order := "DESC"
+		switch strings.ToLower(r.URL.Query().Get("order")) {
+		case "", "desc":
+		case "asc":
+			order = "ASC"
+		default:
+			http.Error(w, "invalid order", http.StatusBadRequest)
+			return
+		}
+
+		// ?min_runnability= hides tracks below the score (and unscored ones)
+		var minRunnability *float64
+		if v := r.URL.Query().Get("min_runnability"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 100 {
+				http.Error(w, "min_runnability must be 0-100", http.StatusBadRequest)
+				return
+			}
+			minRunnability = &f
+		}
+
 		rows, err := s.DB.Query(r.Context(),
-			`SELECT id, title, source_filename, mime_type, duration_sec, original_object_key, created_at
-			 FROM tracks WHERE user_id=$1 ORDER BY created_at DESC`,
-			userID,
+			`SELECT t.id, t.title, t.source_filename, t.mime_type, t.duration_sec, t.original_object_key, t.created_at,
+			        a.bpm, t.bpm_override, a.energy, a.runnability
+			 FROM tracks t
+			 LEFT JOIN track_analysis a ON a.id = t.current_analysis_id
+			 WHERE t.user_id=$1 AND ($2::numeric IS NULL OR a.runnability >= $2)
+			 ORDER BY `+sortExpr+` `+order+` NULLS LAST, t.created_at DESC`,
+			userID, minRunnability,
 		)
 		if err != nil {
 			http.Error(w, "query failed", http.StatusInternalServerError)
@@ -187,7 +261,8 @@ func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
 		for rows.Next() {
 			var tr TrackResponse
 			var created time.Time
-			if err := rows.Scan(&tr.ID, &tr.Title, &tr.SourceFilename, &tr.MimeType, &tr.DurationSec, &tr.OriginalObjectKey, &created); err != nil {
+			if err := rows.Scan(&tr.ID, &tr.Title, &tr.SourceFilename, &tr.MimeType, &tr.DurationSec, &tr.OriginalObjectKey, &created,
+				&tr.Bpm, &tr.BpmOverride, &tr.Energy, &tr.Runnability); err != nil {
 				http.Error(w, "scan failed", http.StatusInternalServerError)
 				return
 			}
@@ -201,12 +276,28 @@ func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// trackSortColumns maps the listing's ?sort= values to ORDER BY expressions.
+var trackSortColumns = map[string]string{
+	"":            "t.created_at",
+	"created_at":  "t.created_at",
+	"bpm":         "COALESCE(t.bpm_override, a.bpm)",
+	"energy":      "a.energy",
+	"runnability": "a.runnability",
+}
+
 func (s *Server) handleTrackByID(w http.ResponseWriter, r *http.Request) {
 	// Routes:
 	// GET  /api/tracks/:id
 	// POST /api/tracks/:id/analyze
 	// POST /api/tracks/:id/render
 	// GET  /api/tracks/:id/analysis
+	// GET  /api/tracks/:id/beats?from=&to=
+	// GET  /api/tracks/:id/analyses
+	// POST /api/tracks/:id/analyses/:analysisId/current
+	// POST /api/tracks/:id/analyses/:analysisId/cancel
+	// PUT|DELETE /api/tracks/:id/bpm
+	// POST /api/tracks/:id/tap
+	// GET  /api/tracks/:id/waveform
 
 	path := strings.TrimPrefix(r.URL.Path, "/api/tracks/")
 	parts := strings.Split(path, "/")
@@ -235,6 +326,34 @@ func (s *Server) handleTrackByID(w http.ResponseWriter, r *http.Request) {
 		s.handleGetAnalysis(w, r, userID, trackID)
 		return
 	}
+	if len(parts) == 2 && parts[1] == "analyses" && r.Method == http.MethodGet {
+		s.handleListAnalyses(w, r, userID, trackID)
+		return
+	}
+	if len(parts) == 4 && parts[1] == "analyses" && parts[3] == "current" && r.Method == http.MethodPost {
+		s.handleSetCurrentAnalysis(w, r, userID, trackID, parts[2])
+		return
+	}
+	if len(parts) == 4 && parts[1] == "analyses" && parts[3] == "cancel" && r.Method == http.MethodPost {
+		s.handleCancelAnalysis(w, r, userID, trackID, parts[2])
+		return
+	}
+	if len(parts) == 2 && parts[1] == "bpm" && (r.Method == http.MethodPut || r.Method == http.MethodDelete) {
+		s.handleBpmOverride(w, r, userID, trackID)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "tap" && r.Method == http.MethodPost {
+		s.handleTapTempo(w, r, userID, trackID)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "waveform" && r.Method == http.MethodGet {
+		s.handleGetTrackWaveform(w, r, userID, trackID)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "beats" && r.Method == http.MethodGet {
+		s.handleGetBeats(w, r, userID, trackID)
+		return
+	}
 
 	// Default: GET /api/tracks/:id
 	if len(parts) == 1 && r.Method == http.MethodGet {
@@ -269,44 +388,60 @@ func (s *Server) handleGetTrack(w http.ResponseWriter, r *http.Request, userID,
 	// Track
 	var tr TrackResponse
 	var created time.Time
+	var override struct {
+		Bpm        *float64
+		OffsetSec  *float64
+		Source     *string
+		Confidence *float64
+		At         *time.Time
+	}
 	err := s.DB.QueryRow(r.Context(),
-		`SELECT id, title, source_filename, mime_type, duration_sec, original_object_key, created_at
+		`SELECT id, title, source_filename, mime_type, duration_sec, original_object_key, created_at,
+		        artist, codec, sample_rate, channels, bitrate_kbps,
+		        bpm_override, bpm_override_offset_sec, bpm_override_source, bpm_override_confidence, bpm_override_at
 		 FROM tracks WHERE id=$1`,
 		trackID,
-	).Scan(&tr.ID, &tr.Title, &tr.SourceFilename, &tr.MimeType, &tr.DurationSec, &tr.OriginalObjectKey, &created)
+	).Scan(&tr.ID, &tr.Title, &tr.SourceFilename, &tr.MimeType, &tr.DurationSec, &tr.OriginalObjectKey, &created,
+		&tr.Artist, &tr.Codec, &tr.SampleRate, &tr.Channels, &tr.BitrateKbps,
+		&override.Bpm, &override.OffsetSec, &override.Source, &override.Confidence, &override.At)
 	if err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	tr.CreatedAt = created.Format(time.RFC3339)
 
-	// Analysis (optional)
+	// Analysis (optional): the current run, or the latest one while none has finished
 	var analysis any = nil
-	var aID *string
-	var bpm *float64
-	var conf *float64
-	var status string
-	var errMsg *string
-	var finished *time.Time
-
-	_ = s.DB.QueryRow(r.Context(),
-		`SELECT id, bpm, confidence, status, error_message, finished_at
-		 FROM track_analysis WHERE track_id=$1`,
+	var detectedBpm *float64
+	if a, err := scanAnalysis(s.DB.QueryRow(r.Context(),
+		`SELECT `+analysisCols+` FROM `+analysisFrom+`
+		 WHERE a.track_id=$1
+		 ORDER BY (a.id = t.current_analysis_id) DESC NULLS LAST, a.created_at DESC
+		 LIMIT 1`,
 		trackID,
-	).Scan(&aID, &bpm, &conf, &status, &errMsg, &finished)
+	)); err == nil {
+		analysis = a.response()
+		if a.IsCurrent {
+			detectedBpm = a.Bpm
+		}
+	}
 
-	if aID != nil {
+	// Both tempos: what analysis found and what the user confirmed.
+	// Renders use the override when there is one.
+	var overrideResp any = nil
+	effectiveBpm := detectedBpm
+	if override.Bpm != nil {
 		m := map[string]any{
-			"id":         *aID,
-			"bpm":        bpm,
-			"confidence": conf,
-			"status":     status,
-			"error":      errMsg,
+			"bpm":             *override.Bpm,
+			"beat_offset_sec": override.OffsetSec,
+			"source":          override.Source,
+			"confidence":      override.Confidence,
 		}
-		if finished != nil {
-			m["finished_at"] = finished.Format(time.RFC3339)
+		if override.At != nil {
+			m["set_at"] = override.At.Format(time.RFC3339)
 		}
-		analysis = m
+		overrideResp = m
+		effectiveBpm = override.Bpm
 	}
 
 	// Latest render (optional)
@@ -315,11 +450,12 @@ func (s *Server) handleGetTrack(w http.ResponseWriter, r *http.Request, userID,
 	var targetBpm *float64
 	var rStatus *string
 	var outKey *string
+	var outFormat *string
 	_ = s.DB.QueryRow(r.Context(),
-		`SELECT id, target_bpm, status, output_object_key
+		`SELECT id, target_bpm, status, output_object_key, output_format
 		 FROM render_jobs WHERE track_id=$1 ORDER BY created_at DESC LIMIT 1`,
 		trackID,
-	).Scan(&rID, &targetBpm, &rStatus, &outKey)
+	).Scan(&rID, &targetBpm, &rStatus, &outKey, &outFormat)
 
 	if rID != nil {
 		latestRender = map[string]any{
@@ -327,12 +463,18 @@ func (s *Server) handleGetTrack(w http.ResponseWriter, r *http.Request, userID,
 			"target_bpm":        *targetBpm,
 			"status":            *rStatus,
 			"output_object_key": outKey,
+			"format":            outFormat,
 		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"track":         tr,
-		"analysis":      analysis,
+		"track":    tr,
+		"analysis": analysis,
+		"bpm": map[string]any{
+			"detected":  detectedBpm,
+			"override":  overrideResp,
+			"effective": effectiveBpm,
+		},
 		"latest_render": latestRender,
 	})
 }
@@ -343,58 +485,74 @@ func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request, userID, t
 		return
 	}
 
-	// Insert or reset analysis row to queued
-	_, err := s.DB.Exec(r.Context(),
+	tx, err := s.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback(r.Context()) }()
+
+	// Each request is a new run; the previous result stays current until it
+	// finishes. A run that is already waiting is reused instead of piling up.
+	// Locking the track makes concurrent requests take turns, so only the
+	// first queues one.
+	if _, err := tx.Exec(r.Context(), `SELECT 1 FROM tracks WHERE id=$1 FOR UPDATE`, trackID); err != nil {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+	var analysisID, status string
+	err = tx.QueryRow(r.Context(),
+		`SELECT id, status FROM track_analysis
+		 WHERE track_id=$1 AND status IN ('queued','running')
+		 ORDER BY created_at DESC LIMIT 1`,
+		trackID,
+	).Scan(&analysisID, &status)
+	if err == nil {
+		writeJSON(w, http.StatusAccepted, AnalyzeResponse{TrackID: trackID, AnalysisID: analysisID, Status: status})
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.QueryRow(r.Context(),
 		`INSERT INTO track_analysis (track_id, status)
 		 VALUES ($1,'queued')
-		 ON CONFLICT (track_id) DO UPDATE
-		   SET status='queued', error_message=NULL, bpm=NULL, confidence=NULL, created_at=now(), finished_at=NULL`,
+		 RETURNING id`,
 		trackID,
-	)
+	).Scan(&analysisID)
 	if err != nil {
 		http.Error(w, "enqueue failed", http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, http.StatusAccepted, AnalyzeResponse{TrackID: trackID, Status: "queued"})
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, AnalyzeResponse{TrackID: trackID, AnalysisID: analysisID, Status: "queued"})
 }
 
+// handleGetAnalysis returns the latest run, so clients can poll a run they
+// just started; is_current tells whether renders use it yet.
 func (s *Server) handleGetAnalysis(w http.ResponseWriter, r *http.Request, userID, trackID string) {
 	if err := s.ensureTrackOwnership(r.Context(), userID, trackID); err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	var id string
-	var bpm *float64
-	var conf *float64
-	var status string
-	var errMsg *string
-	var created time.Time
-	var finished *time.Time
-
-	err := s.DB.QueryRow(r.Context(),
-		`SELECT id, bpm, confidence, status, error_message, created_at, finished_at
-		 FROM track_analysis WHERE track_id=$1`,
+	a, err := scanAnalysis(s.DB.QueryRow(r.Context(),
+		`SELECT `+analysisCols+` FROM `+analysisFrom+`
+		 WHERE a.track_id=$1
+		 ORDER BY a.created_at DESC
+		 LIMIT 1`,
 		trackID,
-	).Scan(&id, &bpm, &conf, &status, &errMsg, &created, &finished)
+	))
 	if err != nil {
 		http.Error(w, "no analysis", http.StatusNotFound)
 		return
 	}
-
-	resp := map[string]any{
-		"id":         id,
-		"track_id":   trackID,
-		"bpm":        bpm,
-		"confidence": conf,
-		"status":     status,
-		"error":      errMsg,
-		"created_at": created.Format(time.RFC3339),
-	}
-	if finished != nil {
-		resp["finished_at"] = finished.Format(time.RFC3339)
-	}
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, a.response())
 }
 
 func (s *Server) handleRender(w http.ResponseWriter, r *http.Request, userID, trackID string) {
@@ -408,6 +566,83 @@ func (s *Server) handleRender(w http.ResponseWriter, r *http.Request, userID, tr
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
+	// A ramp's target_bpm is where it ends up, an interval workout's where
+	// it starts
+	renderMode := "constant"
+	var rampJSON []byte
+	if rp := req.Ramp; rp != nil {
+		opt := *rp
+		if opt.StartBpm < 40 || opt.StartBpm > 260 || opt.EndBpm < 40 || opt.EndBpm > 260 {
+			http.Error(w, "ramp start_bpm/end_bpm out of range", http.StatusBadRequest)
+			return
+		}
+		if opt.Shape == "" {
+			opt.Shape = "linear"
+		}
+		switch opt.Shape {
+		case "linear":
+			opt.Steps = 0
+		case "steps":
+			if opt.Steps == 0 {
+				opt.Steps = 4
+			}
+			if opt.Steps < 2 || opt.Steps > 32 {
+				http.Error(w, "ramp steps must be between 2 and 32", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, `ramp shape must be "linear" or "steps"`, http.StatusBadRequest)
+			return
+		}
+		if opt.DurationSec != nil && *opt.DurationSec <= 0 {
+			http.Error(w, "ramp duration_sec must be positive", http.StatusBadRequest)
+			return
+		}
+		renderMode = "ramp"
+		rampJSON, _ = json.Marshal(opt)
+		req.TargetBpm = opt.EndBpm
+	}
+	var intervalsJSON []byte
+	if iv := req.Intervals; iv != nil {
+		if req.Ramp != nil {
+			http.Error(w, "ramp and intervals can't be combined", http.StatusBadRequest)
+			return
+		}
+		if len(iv.Segments) == 0 || len(iv.Segments) > 64 {
+			http.Error(w, "intervals needs 1 to 64 segments", http.StatusBadRequest)
+			return
+		}
+		for _, seg := range iv.Segments {
+			if seg.DurationSec <= 0 {
+				http.Error(w, "interval duration_sec must be positive", http.StatusBadRequest)
+				return
+			}
+			if seg.TargetBpm < 40 || seg.TargetBpm > 260 {
+				http.Error(w, "interval target_bpm out of range", http.StatusBadRequest)
+				return
+			}
+		}
+		// Stored with defaults applied, as the worker reads it
+		opt := *iv
+		if opt.Repeat == 0 {
+			opt.Repeat = 1
+		}
+		if opt.Repeat < 1 || opt.Repeat > 50 {
+			http.Error(w, "intervals repeat must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		if opt.TransitionBeats == nil {
+			tb := 4
+			opt.TransitionBeats = &tb
+		}
+		if *opt.TransitionBeats < 0 || *opt.TransitionBeats > 16 {
+			http.Error(w, "intervals transition_beats must be between 0 and 16", http.StatusBadRequest)
+			return
+		}
+		renderMode = "intervals"
+		intervalsJSON, _ = json.Marshal(opt)
+		req.TargetBpm = iv.Segments[0].TargetBpm
+	}
 	if req.TargetBpm < 40 || req.TargetBpm > 260 {
 		http.Error(w, "target_bpm out of range", http.StatusBadRequest)
 		return
@@ -415,31 +650,280 @@ func (s *Server) handleRender(w http.ResponseWriter, r *http.Request, userID, tr
 	// tempo_ratio will be computed later by worker once it knows detected BPM
 	// For Phase 1, we set a placeholder ratio = 1.0; worker will update later.
 	tempoRatio := 1.0
-	if !req.PreservePitch {
-		// Keep field for future, but we still preserve pitch for MVP.
+
+	// preserve_pitch=false renders by resampling, so pitch follows tempo
+	preservePitch := req.PreservePitch == nil || *req.PreservePitch
+	engine := stretch.Default(preservePitch)
+	if req.Engine != nil {
+		engine = *req.Engine
+		if !stretch.Valid(engine, "") {
+			http.Error(w, "engine must be one of "+strings.Join(stretch.Engines(), ", "), http.StatusBadRequest)
+			return
+		}
+		if req.PreservePitch != nil && *req.PreservePitch != stretch.PreservesPitch(engine) {
+			http.Error(w, "preserve_pitch conflicts with engine", http.StatusBadRequest)
+			return
+		}
+		preservePitch = stretch.PreservesPitch(engine)
+	}
+	quality := stretch.DefaultPreset(engine)
+	if req.EngineQuality != nil {
+		quality = *req.EngineQuality
+		if !stretch.Valid(engine, quality) {
+			http.Error(w, "engine_quality for "+engine+" must be one of "+strings.Join(stretch.Presets(engine), ", "), http.StatusBadRequest)
+			return
+		}
+	}
+
+	format, _ := audioformat.Lookup(audioformat.Default)
+	if req.Format != nil {
+		f, ok := audioformat.Lookup(*req.Format)
+		if !ok {
+			http.Error(w, "format must be one of "+strings.Join(audioformat.Names(), ", "), http.StatusBadRequest)
+			return
+		}
+		format = f
+	}
+	if req.BitrateKbps != nil {
+		if format.Lossless {
+			http.Error(w, format.Name+" is lossless; bitrate_kbps not allowed", http.StatusBadRequest)
+			return
+		}
+		if !format.ValidBitrate(*req.BitrateKbps) {
+			http.Error(w, fmt.Sprintf("bitrate_kbps for %s must be %d-%d", format.Name, format.MinKbps, format.MaxKbps), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.SampleRate != nil && !renderSampleRates[*req.SampleRate] {
+		http.Error(w, "sample_rate must be 22050, 32000, 44100, 48000, 88200 or 96000", http.StatusBadRequest)
+		return
+	}
+
+	// Loudness targets, NULL when not normalizing
+	settings, err := userSettings(r.Context(), s.DB, userID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	var normLUFS, normTP *float64
+	if n := req.Normalize; (n == nil && settings.Normalize) || (n != nil && n.Enabled) {
+		lufs, tp := settings.TargetLUFS, settings.TruePeak
+		if n != nil && n.TargetLUFS != nil {
+			lufs = *n.TargetLUFS
+		}
+		if n != nil && n.TruePeak != nil {
+			tp = *n.TruePeak
+		}
+		if msg := validateLoudnessTarget(lufs, tp); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		normLUFS, normTP = &lufs, &tp
+	}
+
+	var clickJSON []byte
+	if c := req.Click; c != nil {
+		opt := *c
+		if opt.Sound == "" {
+			opt.Sound = "click"
+		}
+		if !clickSounds[opt.Sound] {
+			http.Error(w, "click sound must be click, wood, beep or tick", http.StatusBadRequest)
+			return
+		}
+		if opt.Every == "" {
+			opt.Every = "beat"
+		}
+		if opt.Every != "beat" && opt.Every != "step" {
+			http.Error(w, `click every must be "beat" or "step"`, http.StatusBadRequest)
+			return
+		}
+		if opt.Volume == nil {
+			v := 0.5
+			opt.Volume = &v
+		}
+		if *opt.Volume <= 0 || *opt.Volume > 1 {
+			http.Error(w, "click volume must be in (0, 1]", http.StatusBadRequest)
+			return
+		}
+		clickJSON, _ = json.Marshal(opt)
+	}
+
+	trimMode := "none"
+	var trimStart, trimEnd *float64
+	if t := req.Trim; t != nil {
+		if t.Auto {
+			trimMode = "auto"
+		} else {
+			if t.Start == nil && t.End == nil {
+				http.Error(w, "trim needs start and/or end", http.StatusBadRequest)
+				return
+			}
+			if (t.Start != nil && *t.Start < 0) || (t.End != nil && *t.End <= 0) {
+				http.Error(w, "trim start/end must be positive", http.StatusBadRequest)
+				return
+			}
+			if t.Start != nil && t.End != nil && *t.End-*t.Start < 1 {
+				http.Error(w, "trim range must be at least 1 second", http.StatusBadRequest)
+				return
+			}
+			trimMode = "manual"
+			trimStart, trimEnd = t.Start, t.End
+		}
+	}
+
+	// The candidate is resolved to its BPM now: the index means nothing
+	// against a later analysis run
+	var candidateBpm *float64
+	if req.TempoCandidate != nil {
+		var n int
+		err := s.DB.QueryRow(r.Context(),
+			`SELECT COALESCE(jsonb_array_length(a.tempo_candidates), 0),
+			        (a.tempo_candidates -> $2::int ->> 'bpm')::float8
+			 FROM tracks t
+			 JOIN track_analysis a ON a.id = t.current_analysis_id
+			 WHERE t.id=$1`,
+			trackID, *req.TempoCandidate,
+		).Scan(&n, &candidateBpm)
+		if err != nil {
+			http.Error(w, "tempo_candidate needs a finished analysis", http.StatusConflict)
+			return
+		}
+		if *req.TempoCandidate < 0 || *req.TempoCandidate >= n || candidateBpm == nil {
+			http.Error(w, "tempo_candidate out of range", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := s.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback(r.Context()) }()
+
+	// A render needs a tempo: the override, or a finished analysis (which
+	// auto trim needs either way). Without one it waits on the pending
+	// analysis run, queuing one if there is none. Locking the pending run
+	// first means the worker can't finish it between our check and insert
+	// without seeing this render.
+	var pendingID *string
+	err = tx.QueryRow(r.Context(),
+		`SELECT id FROM track_analysis
+		 WHERE track_id=$1 AND status IN ('queued','running')
+		 ORDER BY created_at DESC LIMIT 1
+		 FOR SHARE`,
+		trackID,
+	).Scan(&pendingID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+
+	var hasOverride, hasAnalysis bool
+	if err := tx.QueryRow(r.Context(),
+		`SELECT t.bpm_override IS NOT NULL, COALESCE(a.status = 'done', false)
+		 FROM tracks t
+		 LEFT JOIN track_analysis a ON a.id = t.current_analysis_id
+		 WHERE t.id=$1`,
+		trackID,
+	).Scan(&hasOverride, &hasAnalysis); err != nil {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
+
+	status := "queued"
+	var dependsOn *string
+	if !hasAnalysis && (!hasOverride || trimMode == "auto") {
+		if pendingID == nil {
+			var id string
+			if err := tx.QueryRow(r.Context(),
+				`INSERT INTO track_analysis (track_id, status)
+				 VALUES ($1,'queued')
+				 RETURNING id`,
+				trackID,
+			).Scan(&id); err != nil {
+				http.Error(w, "enqueue failed", http.StatusInternalServerError)
+				return
+			}
+			pendingID = &id
+		}
+		status, dependsOn = "waiting", pendingID
+	}
+
+	// An identical finished render of this track (same source file, tempo
+	// and options) is returned as is
+	if status == "queued" && !req.Force {
+		p := rendercache.Params{
+			TargetBpm:         req.TargetBpm,
+			Mode:              renderMode,
+			Ramp:              rampJSON,
+			Intervals:         intervalsJSON,
+			Engine:            engine,
+			Quality:           quality,
+			Format:            format.Name,
+			TrimMode:          trimMode,
+			TrimStart:         trimStart,
+			TrimEnd:           trimEnd,
+			NormalizeLUFS:     normLUFS,
+			NormalizeTruePeak: normTP,
+			Click:             clickJSON,
+		}
+		if req.BitrateKbps != nil {
+			p.BitrateKbps = *req.BitrateKbps
+		}
+		if req.SampleRate != nil {
+			p.SampleRate = *req.SampleRate
+		}
+		cachedID, ok, err := cachedRender(r.Context(), tx, trackID, p, candidateBpm)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			writeJSON(w, http.StatusOK, RenderResponse{RenderID: cachedID, Status: "done", Cached: true})
+			return
+		}
 	}
 
 	var renderID string
-	err := s.DB.QueryRow(r.Context(),
-		`INSERT INTO render_jobs (track_id, target_bpm, tempo_ratio, preserve_pitch, status)
-		 VALUES ($1,$2,$3,$4,'queued')
+	err = tx.QueryRow(r.Context(),
+		`INSERT INTO render_jobs (track_id, target_bpm, tempo_ratio, preserve_pitch, trim_mode, trim_start_sec, trim_end_sec, tempo_candidate,
+		                          status, depends_on_analysis_id, engine, engine_quality, output_format, bitrate_kbps, sample_rate,
+		                          normalize_lufs, normalize_true_peak, click, render_mode, ramp, intervals, tempo_candidate_bpm)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22)
 		 RETURNING id`,
-		trackID, req.TargetBpm, tempoRatio, req.PreservePitch,
+		trackID, req.TargetBpm, tempoRatio, preservePitch, trimMode, trimStart, trimEnd, req.TempoCandidate,
+		status, dependsOn, engine, quality, format.Name, req.BitrateKbps, req.SampleRate,
+		normLUFS, normTP, clickJSON, renderMode, rampJSON, intervalsJSON, candidateBpm,
 	).Scan(&renderID)
 	if err != nil {
 		http.Error(w, "enqueue failed", http.StatusInternalServerError)
 		return
 	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "enqueue failed", http.StatusInternalServerError)
+		return
+	}
 
-	writeJSON(w, http.StatusAccepted, RenderResponse{RenderID: renderID, Status: "queued"})
+	writeJSON(w, http.StatusAccepted, RenderResponse{RenderID: renderID, Status: status, WaitingOnAnalysisID: dependsOn})
 }
 
+// Click sounds the worker can synthesize (its clickSounds)
+var clickSounds = map[string]bool{"click": true, "wood": true, "beep": true, "tick": true}
+
+// Sample rates a render may ask for
+var renderSampleRates = map[int]bool{22050: true, 32000: true, 44100: true, 48000: true, 88200: true, 96000: true}
+
 func (s *Server) handleRenderByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	renderID := strings.TrimPrefix(r.URL.Path, "/api/renders/")
+	// Routes:
+	// GET /api/renders/:id
+	// GET /api/renders/:id/waveform
+	// POST /api/renders/:id/cancel
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/renders/"), "/")
+	renderID := parts[0]
 	if _, err := uuid.Parse(renderID); err != nil {
 		http.Error(w, "invalid uuid", http.StatusBadRequest)
 		return
@@ -447,6 +931,27 @@ func (s *Server) handleRenderByID(w http.ResponseWriter, r *http.Request) {
 
 	userID, _ := UserIDFromContext(r.Context())
 
+	if len(parts) == 2 && parts[1] == "cancel" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleCancelRender(w, r, userID, renderID)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "waveform" {
+		s.handleGetRenderWaveform(w, r, userID, renderID)
+		return
+	}
+	if len(parts) != 1 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
 	// Ensure the render belongs to a track owned by user
 	var (
 		id            string
@@ -455,34 +960,148 @@ func (s *Server) handleRenderByID(w http.ResponseWriter, r *http.Request) {
 		tempoRatio    float64
 		preservePitch bool
 		status        string
-		outputKey     *string
-		errMsg        *string
-		created       time.Time
-		finished      *time.Time
+		trimMode      string
+		trimStart     *float64
+		trimEnd       *float64
+		sourceBpm     *float64
+		sourceOrigin  *string
+		candidate     *int
+		dependsOn     *string
+		engine        *string
+		quality       *string
+		method        *string
+		methodQuality *string
+		outFormat     string
+		bitrateKbps   *int
+		sampleRate    *int
+		outRate       *int
+		outChannels   *int
+		norm          struct {
+			LUFS, TruePeak            *float64
+			InLUFS, InTruePeak, InLRA *float64
+			OutLUFS, OutTruePeak      *float64
+			Type                      *string
+		}
+		click     json.RawMessage
+		mode      string
+		ramp      json.RawMessage
+		intervals json.RawMessage
+		plan      json.RawMessage
+		progress  struct {
+			Fraction *float64
+			Stage    *string
+			EtaSec   *int
+			At       *time.Time
+		}
+		outputKey *string
+		errMsg    *string
+		created   time.Time
+		finished  *time.Time
 	)
 	err := s.DB.QueryRow(r.Context(),
-		`SELECT r.id, r.track_id, r.target_bpm, r.tempo_ratio, r.preserve_pitch, r.status, r.output_object_key, r.error_message, r.created_at, r.finished_at
+		`SELECT r.id, r.track_id, r.target_bpm, r.tempo_ratio, r.preserve_pitch, r.status,
+		        r.trim_mode, r.trim_start_sec, r.trim_end_sec,
+		        r.source_bpm, r.source_bpm_origin, r.tempo_candidate, r.depends_on_analysis_id,
+		        r.engine, r.engine_quality, r.stretch_method, r.stretch_quality,
+		        r.output_format, r.bitrate_kbps, r.sample_rate, r.output_sample_rate, r.output_channels,
+		        r.normalize_lufs, r.normalize_true_peak, r.measured_lufs, r.measured_true_peak, r.measured_lra,
+		        r.normalized_lufs, r.normalized_true_peak, r.normalization_type, r.click,
+		        r.render_mode, r.ramp, r.intervals, r.segment_plan,
+		        r.progress, r.progress_stage, r.eta_sec, r.progress_at,
+		        r.output_object_key, r.error_message, r.created_at, r.finished_at
 		   FROM render_jobs r
 		   JOIN tracks t ON t.id = r.track_id
 		  WHERE r.id=$1 AND t.user_id=$2`,
 		renderID, userID,
-	).Scan(&id, &trackID, &targetBpm, &tempoRatio, &preservePitch, &status, &outputKey, &errMsg, &created, &finished)
+	).Scan(&id, &trackID, &targetBpm, &tempoRatio, &preservePitch, &status,
+		&trimMode, &trimStart, &trimEnd,
+		&sourceBpm, &sourceOrigin, &candidate, &dependsOn,
+		&engine, &quality, &method, &methodQuality,
+		&outFormat, &bitrateKbps, &sampleRate, &outRate, &outChannels,
+		&norm.LUFS, &norm.TruePeak, &norm.InLUFS, &norm.InTruePeak, &norm.InLRA,
+		&norm.OutLUFS, &norm.OutTruePeak, &norm.Type, &click,
+		&mode, &ramp, &intervals, &plan,
+		&progress.Fraction, &progress.Stage, &progress.EtaSec, &progress.At,
+		&outputKey, &errMsg, &created, &finished)
 	if err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
 	resp := map[string]any{
-		"id":                id,
-		"track_id":          trackID,
-		"target_bpm":        targetBpm,
-		"tempo_ratio":       tempoRatio,
-		"preserve_pitch":    preservePitch,
-		"status":            status,
+		"id":             id,
+		"track_id":       trackID,
+		"target_bpm":     targetBpm,
+		"tempo_ratio":    tempoRatio,
+		"preserve_pitch": preservePitch,
+		"status":         status,
+		// Requested engine, and what ran (differs after a fallback)
+		"engine":          engine,
+		"engine_quality":  quality,
+		"stretch_method":  method,
+		"stretch_quality": methodQuality,
+		"trim": map[string]any{
+			"mode":  trimMode,
+			"start": trimStart,
+			"end":   trimEnd,
+		},
+		"source_bpm":        sourceBpm,
+		"source_bpm_origin": sourceOrigin,
+		"tempo_candidate":   candidate,
+		"format":            outFormat,
+		"bitrate_kbps":      bitrateKbps,
+		"click":             click,
+		"mode":              mode,
+		"ramp":              ramp,
+		"intervals":         intervals,
+		// Source range -> output range at each tempo, filled in by the worker
+		"segment_plan": plan,
+		"sample_rate":  sampleRate,
+		"output": map[string]any{
+			"sample_rate": outRate,
+			"channels":    outChannels,
+		},
 		"output_object_key": outputKey,
 		"error":             errMsg,
 		"created_at":        created.Format(time.RFC3339),
 	}
+	if norm.LUFS != nil {
+		resp["normalize"] = map[string]any{
+			"target_lufs":    norm.LUFS,
+			"true_peak_dbtp": norm.TruePeak,
+			// Measured on the stretched audio (first loudnorm pass) and
+			// after normalizing; type is "dynamic" when loudnorm couldn't
+			// reach the target with a linear gain, "skipped" when the audio
+			// was too quiet to measure (left as is)
+			"measured": map[string]any{
+				"integrated_lufs": norm.InLUFS,
+				"true_peak_dbtp":  norm.InTruePeak,
+				"range_lu":        norm.InLRA,
+			},
+			"output": map[string]any{
+				"integrated_lufs": norm.OutLUFS,
+				"true_peak_dbtp":  norm.OutTruePeak,
+			},
+			"type": norm.Type,
+		}
+	} else {
+		resp["normalize"] = nil
+	}
+	if f, ok := audioformat.Lookup(outFormat); ok {
+		resp["content_type"] = f.ContentType
+	}
+	// Fraction done (0..1) and seconds left, as last reported by the worker;
+	// null until it starts
+	resp["progress"] = progress.Fraction
+	resp["progress_stage"] = progress.Stage
+	resp["eta_sec"] = progress.EtaSec
+	if progress.At != nil {
+		resp["progress_at"] = progress.At.Format(time.RFC3339)
+	}
+	// 'waiting': queued behind this analysis run, which will provide the tempo
+	if status == "waiting" {
+		resp["waiting_on_analysis_id"] = dependsOn
+	}
 	if finished != nil {
 		resp["finished_at"] = finished.Format(time.RFC3339)
 	}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/rendercache"
+	"github.com/jackc/pgx/v5"
+)
+
+// cachedRender finds a finished render of the track with the same inputs as
+// p would have once the worker resolves the track's tempo. Renders of other
+// tracks never match, even from an identical upload: the result has to show
+// up on this track. p carries the
+// request's options; the source hash, source tempo and beat grid are filled
+// in here the way runRenderJob picks them. candidateBpm is the picked tempo
+// candidate's BPM, if any. ok is false when there is none, or the track's
+// tempo or hash isn't known yet.
+func cachedRender(ctx context.Context, q rowQuerier, trackID string, p rendercache.Params, candidateBpm *float64) (renderID string, ok bool, err error) {
+	var (
+		sourceHash, analysisID, aStatus *string
+		overrideBpm, overrideOffset     *float64
+		analysisBpm                     *float64
+	)
+	err = q.QueryRow(ctx,
+		`SELECT t.source_sha256, t.current_analysis_id, t.bpm_override, t.bpm_override_offset_sec,
+		        a.bpm, a.status
+		 FROM tracks t
+		 LEFT JOIN track_analysis a ON a.id = t.current_analysis_id
+		 WHERE t.id=$1`,
+		trackID,
+	).Scan(&sourceHash, &analysisID, &overrideBpm, &overrideOffset, &analysisBpm, &aStatus)
+	if err != nil {
+		return "", false, err
+	}
+	if sourceHash == nil {
+		return "", false, nil
+	}
+	p.SourceSHA256 = *sourceHash
+	if analysisID != nil {
+		p.AnalysisID = *analysisID
+	}
+
+	switch {
+	case candidateBpm != nil:
+		p.SourceBpm = *candidateBpm
+	case overrideBpm != nil && *overrideBpm > 0:
+		p.SourceBpm, p.BeatOffset = *overrideBpm, overrideOffset
+	case aStatus != nil && *aStatus == "done" && analysisBpm != nil && *analysisBpm > 0:
+		p.SourceBpm = *analysisBpm
+	default:
+		return "", false, nil
+	}
+
+	err = q.QueryRow(ctx,
+		`SELECT id
+		 FROM render_jobs
+		 WHERE track_id=$1 AND cache_key=$2 AND status='done'
+		 ORDER BY finished_at DESC
+		 LIMIT 1`,
+		trackID, rendercache.Key(p),
+	).Scan(&renderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return renderID, true, nil
+}
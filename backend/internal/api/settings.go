@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// rowQuerier is what both the pool and a transaction offer.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type UserSettings struct {
+	// Queue analysis as soon as a track is created
+	AutoAnalyze bool `json:"auto_analyze"`
+
+	// Default loudness normalization for renders that don't say
+	Normalize  bool    `json:"normalize"`
+	TargetLUFS float64 `json:"target_lufs"`
+	TruePeak   float64 `json:"true_peak_dbtp"`
+}
+
+// UpdateSettingsRequest is a partial update: omitted fields keep their value.
+type UpdateSettingsRequest struct {
+	AutoAnalyze *bool    `json:"auto_analyze"`
+	Normalize   *bool    `json:"normalize"`
+	TargetLUFS  *float64 `json:"target_lufs"`
+	TruePeak    *float64 `json:"true_peak_dbtp"`
+}
+
+func defaultUserSettings() UserSettings {
+	return UserSettings{AutoAnalyze: true, TargetLUFS: defaultTargetLUFS, TruePeak: defaultTruePeak}
+}
+
+// userSettings loads the user's settings, falling back to defaults when the
+// user never saved any. q is the pool or a transaction.
+func userSettings(ctx context.Context, q rowQuerier, userID string) (UserSettings, error) {
+	st := defaultUserSettings()
+	err := q.QueryRow(ctx,
+		`SELECT auto_analyze, normalize, target_lufs, true_peak_dbtp FROM user_settings WHERE user_id=$1`,
+		userID,
+	).Scan(&st.AutoAnalyze, &st.Normalize, &st.TargetLUFS, &st.TruePeak)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return st, err
+	}
+	return st, nil
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	// Routes:
+	// GET /api/me/settings
+	// PUT /api/me/settings
+	userID, _ := UserIDFromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		st, err := userSettings(r.Context(), s.DB, userID)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+
+	case http.MethodPut:
+		var req UpdateSettingsRequest
+		if err := readJSON(r, &req); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		st, err := userSettings(r.Context(), s.DB, userID)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		if req.AutoAnalyze != nil {
+			st.AutoAnalyze = *req.AutoAnalyze
+		}
+		if req.Normalize != nil {
+			st.Normalize = *req.Normalize
+		}
+		if req.TargetLUFS != nil {
+			st.TargetLUFS = *req.TargetLUFS
+		}
+		if req.TruePeak != nil {
+			st.TruePeak = *req.TruePeak
+		}
+		if msg := validateLoudnessTarget(st.TargetLUFS, st.TruePeak); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if _, err := s.DB.Exec(r.Context(),
+			`INSERT INTO user_settings (user_id, auto_analyze, normalize, target_lufs, true_peak_dbtp, updated_at)
+			 VALUES ($1,$2,$3,$4,$5,$6)
+			 ON CONFLICT (user_id) DO UPDATE
+			 SET auto_analyze=EXCLUDED.auto_analyze,
+			     normalize=EXCLUDED.normalize,
+			     target_lufs=EXCLUDED.target_lufs,
+			     true_peak_dbtp=EXCLUDED.true_peak_dbtp,
+			     updated_at=EXCLUDED.updated_at`,
+			userID, st.AutoAnalyze, st.Normalize, st.TargetLUFS, st.TruePeak, time.Now(),
+		); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Streaming services normalize to about -14 LUFS; -1 dBTP leaves headroom
+// for lossy encoding
+const (
+	defaultTargetLUFS = -14.0
+	defaultTruePeak   = -1.0
+)
+
+// validateLoudnessTarget checks the ranges ffmpeg's loudnorm accepts and
+// returns an error message, or "" when valid.
+func validateLoudnessTarget(lufs, truePeak float64) string {
+	if lufs < -70 || lufs > -5 {
+		return "target_lufs must be between -70 and -5"
+	}
+	if truePeak < -9 || truePeak > 0 {
+		return "true_peak_dbtp must be between -9 and 0"
+	}
+	return ""
+}
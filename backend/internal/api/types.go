@@ -1,5 +1,11 @@
 package api
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
 type SignupRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -30,19 +36,183 @@ type TrackResponse struct {
 	DurationSec       *int    `json:"duration_sec,omitempty"`
 	OriginalObjectKey string  `json:"original_object_key"`
 	CreatedAt         string  `json:"created_at"`
+
+	// Ingested from the file by the first analysis run
+	Artist      *string `json:"artist,omitempty"`
+	Codec       *string `json:"codec,omitempty"`
+	SampleRate  *int    `json:"sample_rate,omitempty"`
+	Channels    *int    `json:"channels,omitempty"`
+	BitrateKbps *int    `json:"bitrate_kbps,omitempty"`
+
+	// Listing only: from the finished analysis, if any
+	Bpm         *float64 `json:"bpm,omitempty"`
+	BpmOverride *float64 `json:"bpm_override,omitempty"`
+	Energy      *float64 `json:"energy,omitempty"`
+	Runnability *float64 `json:"runnability,omitempty"`
 }
 
 type AnalyzeResponse struct {
-	TrackID string `json:"track_id"`
-	Status  string `json:"status"`
+	TrackID    string `json:"track_id"`
+	AnalysisID string `json:"analysis_id"`
+	Status     string `json:"status"`
 }
 
 type RenderRequest struct {
-	TargetBpm     float64 `json:"target_bpm"`
-	PreservePitch bool    `json:"preserve_pitch"`
+	TargetBpm     float64     `json:"target_bpm"`
+	PreservePitch *bool       `json:"preserve_pitch,omitempty"` // default true
+	Trim          *TrimOption `json:"trim,omitempty"`
+
+	// Time-stretch engine ("atempo", "rubberband", "resample") and one of its
+	// quality presets. The engine implies preserve_pitch; without one,
+	// preserve_pitch picks atempo or resample.
+	Engine        *string `json:"engine,omitempty"`
+	EngineQuality *string `json:"engine_quality,omitempty"`
+
+	// Output encoding: mp3 (default), m4a/aac, opus, flac or wav, and a
+	// bitrate for the lossy ones (default: the format's usual quality)
+	Format      *string `json:"format,omitempty"`
+	BitrateKbps *int    `json:"bitrate_kbps,omitempty"`
+
+	// Output sample rate in Hz; default is the source's. Channels always
+	// follow the source.
+	SampleRate *int `json:"sample_rate,omitempty"`
+
+	// Loudness normalization; default from the user's settings
+	Normalize *NormalizeOption `json:"normalize,omitempty"`
+
+	// Metronome click mixed over the music, on the beat grid
+	Click *ClickOption `json:"click,omitempty"`
+
+	// Tempo ramp from start_bpm to end_bpm; replaces target_bpm
+	Ramp *RampOption `json:"ramp,omitempty"`
+
+	// Interval workout: a tempo per stretch of output time; replaces
+	// target_bpm. Only one of ramp and intervals may be given.
+	Intervals *IntervalsOption `json:"intervals,omitempty"`
+
+	// Index into the current analysis' tempo_candidates; stretches from that
+	// reading instead of the selected BPM (or the override)
+	TempoCandidate *int `json:"tempo_candidate,omitempty"`
+
+	// Render again even if an identical finished render exists
+	Force bool `json:"force,omitempty"`
+}
+
+// TrimOption is either the string "auto" (cut the detected intro/outro) or
+// an explicit {"start": s, "end": s} range on the source timeline.
+type TrimOption struct {
+	Auto  bool
+	Start *float64
+	End   *float64
+}
+
+func (t *TrimOption) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '"' {
+		var mode string
+		if err := json.Unmarshal(b, &mode); err != nil {
+			return err
+		}
+		if mode != "auto" {
+			return errors.New(`trim must be "auto" or {"start","end"}`)
+		}
+		*t = TrimOption{Auto: true}
+		return nil
+	}
+
+	var r struct {
+		Start *float64 `json:"start"`
+		End   *float64 `json:"end"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return err
+	}
+	*t = TrimOption{Start: r.Start, End: r.End}
+	return nil
+}
+
+func (t TrimOption) MarshalJSON() ([]byte, error) {
+	if t.Auto {
+		return json.Marshal("auto")
+	}
+	return json.Marshal(map[string]*float64{"start": t.Start, "end": t.End})
+}
+
+// NormalizeOption is either a bool (on with the user's targets, or off) or
+// {"target_lufs": l, "true_peak_dbtp": p}, which turns it on with those
+// targets (either may be omitted).
+type NormalizeOption struct {
+	Enabled    bool
+	TargetLUFS *float64
+	TruePeak   *float64
+}
+
+func (n *NormalizeOption) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("true")) || bytes.Equal(b, []byte("false")) {
+		*n = NormalizeOption{Enabled: b[0] == 't'}
+		return nil
+	}
+
+	var r struct {
+		TargetLUFS *float64 `json:"target_lufs"`
+		TruePeak   *float64 `json:"true_peak_dbtp"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return errors.New(`normalize must be a bool or {"target_lufs","true_peak_dbtp"}`)
+	}
+	*n = NormalizeOption{Enabled: true, TargetLUFS: r.TargetLUFS, TruePeak: r.TruePeak}
+	return nil
+}
+
+func (n NormalizeOption) MarshalJSON() ([]byte, error) {
+	if !n.Enabled || (n.TargetLUFS == nil && n.TruePeak == nil) {
+		return json.Marshal(n.Enabled)
+	}
+	return json.Marshal(map[string]*float64{"target_lufs": n.TargetLUFS, "true_peak_dbtp": n.TruePeak})
+}
+
+type ClickOption struct {
+	Sound  string   `json:"sound"`            // "click" (default), "wood", "beep", "tick"
+	Volume *float64 `json:"volume,omitempty"` // 0..1, default 0.5
+	Every  string   `json:"every"`            // "beat" (default) or "step": also on off-beats, for songs at half cadence
+}
+
+type RampOption struct {
+	StartBpm float64 `json:"start_bpm"`
+	EndBpm   float64 `json:"end_bpm"`
+	Shape    string  `json:"shape"`           // "linear" (default) or "steps"
+	Steps    int     `json:"steps,omitempty"` // number of tempo levels for "steps", default 4
+
+	// Ramp over this many seconds of output, then hold end_bpm; default is
+	// the whole track
+	DurationSec *float64 `json:"duration_sec,omitempty"`
+}
+
+// IntervalsOption plays each segment's tempo for its duration (output
+// seconds), the whole list repeat times, then holds the last tempo.
+type IntervalsOption struct {
+	Segments []IntervalSegment `json:"segments"`
+	Repeat   int               `json:"repeat,omitempty"` // default 1
+
+	// Beats over which the tempo steps between intervals; default 4, 0
+	// switches on a single beat
+	TransitionBeats *int `json:"transition_beats,omitempty"`
+}
+
+type IntervalSegment struct {
+	DurationSec float64 `json:"duration_sec"`
+	TargetBpm   float64 `json:"target_bpm"`
 }
 
 type RenderResponse struct {
 	RenderID string `json:"render_id"`
-	Status   string `json:"status"`
+	Status   string `json:"status"` // "queued", "waiting" on an analysis run, or "done" when cached
+	Cached   bool   `json:"cached,omitempty"`
+
+	WaitingOnAnalysisID *string `json:"waiting_on_analysis_id,omitempty"`
 }
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"io"
+	"net/http"
+)
+
+// handleGetTrackWaveform serves the source audio's peak data, written by the
+// worker during analysis.
+func (s *Server) handleGetTrackWaveform(w http.ResponseWriter, r *http.Request, userID, trackID string) {
+	var key *string
+	err := s.DB.QueryRow(r.Context(),
+		`SELECT waveform_object_key FROM tracks WHERE id=$1 AND user_id=$2`,
+		trackID, userID,
+	).Scan(&key)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if key == nil {
+		http.Error(w, "waveform not ready (run analysis)", http.StatusConflict)
+		return
+	}
+	s.serveWaveform(w, r, *key)
+}
+
+// handleGetRenderWaveform serves a finished render's peak data.
+func (s *Server) handleGetRenderWaveform(w http.ResponseWriter, r *http.Request, userID, renderID string) {
+	var key *string
+	err := s.DB.QueryRow(r.Context(),
+		`SELECT r.waveform_object_key
+		   FROM render_jobs r
+		   JOIN tracks t ON t.id = r.track_id
+		  WHERE r.id=$1 AND t.user_id=$2`,
+		renderID, userID,
+	).Scan(&key)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if key == nil {
+		http.Error(w, "waveform not ready", http.StatusConflict)
+		return
+	}
+	s.serveWaveform(w, r, *key)
+}
+
+func (s *Server) serveWaveform(w http.ResponseWriter, r *http.Request, key string) {
+	body, _, err := s.R2.GetObjectStream(r.Context(), key)
+	if err != nil {
+		http.Error(w, "failed to fetch object", http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=0")
+	_, _ = io.Copy(w, body)
+}
@@ -52,8 +52,20 @@ export const apiLogin = (email, password) =>
 
 export const apiMe = () => request("/api/me");
 
+// Settings: { auto_analyze, normalize, target_lufs, true_peak_dbtp }
+export const apiGetSettings = () => request("/api/me/settings");
+export const apiUpdateSettings = (patch) =>
+  request("/api/me/settings", { method: "PUT", body: patch });
+
 // Tracks
-export const apiListTracks = () => request("/api/tracks");
+export const apiListTracks = ({ sort, order, minRunnability } = {}) => {
+  const q = new URLSearchParams();
+  if (sort) q.set("sort", sort);
+  if (order) q.set("order", order);
+  if (minRunnability != null) q.set("min_runnability", String(minRunnability));
+  const qs = q.toString();
+  return request(`/api/tracks${qs ? `?${qs}` : ""}`);
+};
 export const apiCreateTrack = (payload) =>
   request("/api/tracks", { method: "POST", body: payload });
 
@@ -66,12 +78,50 @@ export const apiAnalyze = (trackId) =>
 export const apiGetAnalysis = (trackId) =>
   request(`/api/tracks/${trackId}/analysis`);
 
+export const apiListAnalyses = (trackId) =>
+  request(`/api/tracks/${trackId}/analyses`);
+
+export const apiSetCurrentAnalysis = (trackId, analysisId) =>
+  request(`/api/tracks/${trackId}/analyses/${analysisId}/current`, { method: "POST" });
+
+export const apiCancelAnalysis = (trackId, analysisId) =>
+  request(`/api/tracks/${trackId}/analyses/${analysisId}/cancel`, { method: "POST" });
+
+export const apiGetBeats = (trackId, { from, to } = {}) => {
+  const q = new URLSearchParams();
+  if (from != null) q.set("from", from);
+  if (to != null) q.set("to", to);
+  const qs = q.toString();
+  return request(`/api/tracks/${trackId}/beats${qs ? `?${qs}` : ""}`);
+};
+
+// Waveform peaks: { sample_rate, duration_sec, levels: [{ samples_per_pixel, length, data: [min, max, ...] }] }
+export const apiGetTrackWaveform = (trackId) => request(`/api/tracks/${trackId}/waveform`);
+
+// Manual tempo
+export const apiSetBpm = (trackId, bpm, beatOffsetSec) =>
+  request(`/api/tracks/${trackId}/bpm`, {
+    method: "PUT",
+    body: { bpm, beat_offset_sec: beatOffsetSec ?? null },
+  });
+
+export const apiClearBpm = (trackId) =>
+  request(`/api/tracks/${trackId}/bpm`, { method: "DELETE" });
+
+export const apiTapTempo = (trackId, tapTimes) =>
+  request(`/api/tracks/${trackId}/tap`, { method: "POST", body: { tap_times: tapTimes } });
+
 // Render
 export const apiRender = (trackId, payload) =>
   request(`/api/tracks/${trackId}/render`, { method: "POST", body: payload });
 
 export const apiGetRender = (renderId) => request(`/api/renders/${renderId}`);
 
+export const apiCancelRender = (renderId) =>
+  request(`/api/renders/${renderId}/cancel`, { method: "POST" });
+
+export const apiGetRenderWaveform = (renderId) => request(`/api/renders/${renderId}/waveform`);
+
 /**
  * =========================
  * Phase B: Signed uploads
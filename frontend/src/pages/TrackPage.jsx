@@ -2,6 +2,7 @@ import { useEffect, useMemo, useState } from "react";
 import { useParams } from "react-router-dom";
 import {
   apiAnalyze,
+  apiCancelRender,
   apiGetAnalysis,
   apiGetRender,
   apiGetTrack,
@@ -30,6 +31,7 @@ export default function TrackPage() {
   const [pace, setPace] = useState("8:00"); // mm:ss per mile
   const [beatMode, setBeatMode] = useState("step"); // step | stride
   const [renderStatus, setRenderStatus] = useState(null);
+  const [activeRenderId, setActiveRenderId] = useState(null);
   const [analysisStatus, setAnalysisStatus] = useState(null);
 
   // Audio blob state (JWT-friendly)
@@ -152,18 +154,47 @@ export default function TrackPage() {
         preserve_pitch: true,
       });
       const renderId = res.render_id;
+      // An identical render already exists
+      if (res.cached) {
+        setRenderStatus("done (cached)");
+        await refresh();
+        return;
+      }
+      // "waiting" renders start once the track's analysis finishes
+      if (res.status === "waiting") setRenderStatus("waiting for analysis...");
+      setActiveRenderId(renderId);
+      // The worker reports progress while running; it gives a render at
+      // most 12 minutes
       const result = await poll(() => apiGetRender(renderId), {
         intervalMs: 2000,
-        timeoutMs: 90000,
+        timeoutMs: 14 * 60 * 1000,
+        onUpdate: (r) => {
+          if (r?.status !== "running" || r.progress == null) return;
+          const pct = Math.round(r.progress * 100);
+          const eta = r.eta_sec != null ? ` • ~${r.eta_sec}s left` : "";
+          setRenderStatus(`rendering ${pct}%${eta}`);
+        },
       });
+      setActiveRenderId(null);
       setRenderStatus(result.status);
       await refresh();
     } catch (e) {
+      setActiveRenderId(null);
       setErr(e.message || "Generate failed");
       setRenderStatus("failed");
     }
   }
 
+  async function doCancelRender() {
+    if (!activeRenderId) return;
+    try {
+      await apiCancelRender(activeRenderId);
+      setRenderStatus("canceling...");
+    } catch (e) {
+      setErr(e.message || "Cancel failed");
+    }
+  }
+
   // Early returns AFTER hooks
   if (busy) return <p>Loading...</p>;
   if (err) return <p style={{ color: "crimson" }}>{err}</p>;
@@ -293,6 +324,11 @@ export default function TrackPage() {
         <button style={{ marginTop: 10 }} onClick={doGenerate}>
           Generate
         </button>
+        {activeRenderId && (
+          <button style={{ marginTop: 10, marginLeft: 8 }} onClick={doCancelRender}>
+            Cancel
+          </button>
+        )}
         {renderStatus && (
           <span style={{ marginLeft: 10, color: "#666" }}>{renderStatus}</span>
         )}
@@ -317,8 +353,8 @@ export default function TrackPage() {
             <>
               <audio controls src={audioUrl} />
               <div style={{ marginTop: 8 }}>
-                <a href={audioUrl} download="run-version.mp3">
-                  Download MP3
+                <a href={audioUrl} download={`run-version.${latestRender.format ?? "mp3"}`}>
+                  Download {(latestRender.format ?? "mp3").toUpperCase()}
                 </a>
               </div>
             </>
@@ -1,9 +1,11 @@
-export async function poll(fn, { intervalMs = 2000, timeoutMs = 60000 } = {}) {
+// onUpdate, if given, sees every intermediate result (e.g. render progress).
+export async function poll(fn, { intervalMs = 2000, timeoutMs = 60000, onUpdate } = {}) {
   const start = Date.now();
   // eslint-disable-next-line no-constant-condition
   while (true) {
     const result = await fn();
-    if (result?.status === "done" || result?.status === "failed") return result;
+    onUpdate?.(result);
+    if (["done", "failed", "canceled"].includes(result?.status)) return result;
     if (Date.now() - start > timeoutMs) throw new Error("Timed out waiting for job");
     await new Promise((r) => setTimeout(r, intervalMs));
   }
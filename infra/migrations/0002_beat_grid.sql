@@ -0,0 +1,3 @@
+-- Beat grid: every detected beat, in seconds from the start of the original file
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS beat_times real[];
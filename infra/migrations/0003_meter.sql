@@ -0,0 +1,7 @@
+-- Meter: time signature estimated from accent patterns on the beat grid,
+-- plus the downbeat (bar start) times in seconds.
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS time_signature text,
+  ADD COLUMN IF NOT EXISTS beats_per_bar int,
+  ADD COLUMN IF NOT EXISTS meter_confidence numeric,
+  ADD COLUMN IF NOT EXISTS bar_times real[];
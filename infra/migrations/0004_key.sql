@@ -0,0 +1,7 @@
+-- Musical key: tonic + mode from chroma/key-profile correlation, with the
+-- Camelot wheel code used for harmonic playlist ordering.
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS key_tonic text,
+  ADD COLUMN IF NOT EXISTS key_mode text,
+  ADD COLUMN IF NOT EXISTS key_camelot text,
+  ADD COLUMN IF NOT EXISTS key_confidence numeric;
@@ -0,0 +1,8 @@
+-- Loudness (EBU R128) and energy. energy_curve holds the RMS level in dBFS
+-- of each 10-second window; energy is the 0..1 summary used for sorting.
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS loudness_lufs numeric,
+  ADD COLUMN IF NOT EXISTS loudness_range_lu numeric,
+  ADD COLUMN IF NOT EXISTS true_peak_dbtp numeric,
+  ADD COLUMN IF NOT EXISTS energy numeric,
+  ADD COLUMN IF NOT EXISTS energy_curve real[];
@@ -0,0 +1,18 @@
+-- Song sections: where the intro ends and the outro starts (beat-snapped),
+-- plus every silent region, as [{"start":s,"end":s}, ...].
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS duration_sec numeric,
+  ADD COLUMN IF NOT EXISTS intro_end_sec numeric,
+  ADD COLUMN IF NOT EXISTS outro_start_sec numeric,
+  ADD COLUMN IF NOT EXISTS silences jsonb;
+
+-- Render trim: 'auto' cuts the detected intro/outro, 'manual' uses the given
+-- range. The worker records the range it actually used.
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS trim_mode text NOT NULL DEFAULT 'none',
+  ADD COLUMN IF NOT EXISTS trim_start_sec numeric,
+  ADD COLUMN IF NOT EXISTS trim_end_sec numeric;
+
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_trim_mode_chk
+  CHECK (trim_mode IN ('none','auto','manual'));
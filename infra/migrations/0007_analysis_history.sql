@@ -0,0 +1,24 @@
+-- Analysis history: every run is kept (no more one-row-per-track), tagged
+-- with the algorithm version and parameters that produced it. The track
+-- points at the run currently in use.
+ALTER TABLE track_analysis
+  DROP CONSTRAINT IF EXISTS track_analysis_track_id_key;
+
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS algorithm text,
+  ADD COLUMN IF NOT EXISTS algorithm_version text,
+  ADD COLUMN IF NOT EXISTS params jsonb,
+  ADD COLUMN IF NOT EXISTS raw_candidates jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_track_analysis_track_created ON track_analysis(track_id, created_at DESC);
+
+ALTER TABLE tracks
+  ADD COLUMN IF NOT EXISTS current_analysis_id uuid REFERENCES track_analysis(id) ON DELETE SET NULL;
+
+-- Existing finished analyses become current
+UPDATE tracks t
+SET current_analysis_id = a.id
+FROM track_analysis a
+WHERE a.track_id = t.id
+  AND a.status = 'done'
+  AND t.current_analysis_id IS NULL;
@@ -0,0 +1,16 @@
+-- User-confirmed tempo. Takes precedence over the analysis BPM for renders.
+ALTER TABLE tracks
+  ADD COLUMN IF NOT EXISTS bpm_override numeric,
+  ADD COLUMN IF NOT EXISTS bpm_override_offset_sec numeric,
+  ADD COLUMN IF NOT EXISTS bpm_override_source text,
+  ADD COLUMN IF NOT EXISTS bpm_override_confidence numeric,
+  ADD COLUMN IF NOT EXISTS bpm_override_at timestamptz;
+
+ALTER TABLE tracks
+  ADD CONSTRAINT tracks_bpm_override_source_chk
+  CHECK (bpm_override_source IN ('manual','tap'));
+
+-- Which tempo a render was stretched from
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS source_bpm numeric,
+  ADD COLUMN IF NOT EXISTS source_bpm_origin text;
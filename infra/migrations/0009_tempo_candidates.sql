@@ -0,0 +1,9 @@
+-- Every tempo reading the analysis considered, ranked:
+-- [{"bpm":..,"score":..,"sources":[..],"octave":"x2","selected":false}, ...]
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS tempo_candidates jsonb;
+
+-- Render from a specific candidate (index into tempo_candidates) instead of
+-- the selected BPM
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS tempo_candidate int;
@@ -0,0 +1,5 @@
+-- Runnability: 0..100 score for how well a track works for running, with
+-- the per-component breakdown and the stretch needed to reach a running cadence.
+ALTER TABLE track_analysis
+  ADD COLUMN IF NOT EXISTS runnability numeric,
+  ADD COLUMN IF NOT EXISTS runnability_detail jsonb;
@@ -0,0 +1,7 @@
+-- Waveform peaks (JSON, multi-resolution min/max) for the player, stored in
+-- object storage next to the audio they describe.
+ALTER TABLE tracks
+  ADD COLUMN IF NOT EXISTS waveform_object_key text;
+
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS waveform_object_key text;
@@ -0,0 +1,15 @@
+-- Per-user preferences. A missing row means defaults.
+CREATE TABLE IF NOT EXISTS user_settings (
+  user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  auto_analyze boolean NOT NULL DEFAULT true,
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Source metadata ingested by the worker (ffprobe) during analysis
+ALTER TABLE tracks
+  ADD COLUMN IF NOT EXISTS artist text,
+  ADD COLUMN IF NOT EXISTS codec text,
+  ADD COLUMN IF NOT EXISTS sample_rate int,
+  ADD COLUMN IF NOT EXISTS channels int,
+  ADD COLUMN IF NOT EXISTS bitrate_kbps int,
+  ADD COLUMN IF NOT EXISTS metadata_at timestamptz;
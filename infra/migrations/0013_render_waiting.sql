@@ -0,0 +1,12 @@
+-- Renders requested before the track has a tempo wait on the analysis run
+-- that will provide one: 'waiting' until it finishes, then 'queued' (or
+-- 'failed' if the analysis fails).
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS depends_on_analysis_id uuid REFERENCES track_analysis(id) ON DELETE SET NULL;
+
+ALTER TABLE render_jobs DROP CONSTRAINT IF EXISTS render_jobs_status_chk;
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_status_chk
+  CHECK (status IN ('waiting','queued','running','done','failed'));
+
+CREATE INDEX IF NOT EXISTS idx_render_jobs_waiting ON render_jobs(depends_on_analysis_id) WHERE status = 'waiting';
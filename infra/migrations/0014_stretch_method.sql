@@ -0,0 +1,4 @@
+-- How the render changed tempo: 'atempo' (pitch preserved) or 'resample'
+-- (pitch follows tempo, "vinyl" mode). Set by the worker when done.
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS stretch_method text;
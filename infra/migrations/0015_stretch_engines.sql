@@ -0,0 +1,16 @@
+-- Requested time-stretch engine and quality preset. stretch_method and
+-- stretch_quality record what actually ran (the worker falls back to atempo
+-- when an engine isn't installed).
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS engine text,
+  ADD COLUMN IF NOT EXISTS engine_quality text,
+  ADD COLUMN IF NOT EXISTS stretch_quality text;
+
+UPDATE render_jobs
+SET engine = CASE WHEN preserve_pitch THEN 'atempo' ELSE 'resample' END
+WHERE engine IS NULL;
+
+ALTER TABLE render_jobs DROP CONSTRAINT IF EXISTS render_jobs_engine_chk;
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_engine_chk
+  CHECK (engine IS NULL OR engine IN ('atempo','rubberband','resample'));
@@ -0,0 +1,10 @@
+-- Render output encoding. bitrate_kbps NULL means the format's default
+-- (VBR for mp3); lossless formats have none.
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS output_format text NOT NULL DEFAULT 'mp3',
+  ADD COLUMN IF NOT EXISTS bitrate_kbps int;
+
+ALTER TABLE render_jobs DROP CONSTRAINT IF EXISTS render_jobs_output_format_chk;
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_output_format_chk
+  CHECK (output_format IN ('mp3','m4a','opus','flac','wav'));
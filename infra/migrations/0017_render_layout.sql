@@ -0,0 +1,6 @@
+-- Renders keep the source's channels and sample rate. sample_rate is the
+-- requested rate (NULL = source's); output_* record what was encoded.
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS sample_rate int,
+  ADD COLUMN IF NOT EXISTS output_sample_rate int,
+  ADD COLUMN IF NOT EXISTS output_channels int;
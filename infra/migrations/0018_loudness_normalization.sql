@@ -0,0 +1,18 @@
+-- Loudness normalization on render (two-pass loudnorm). normalize_* are the
+-- targets (NULL = not normalized); the worker stores what it measured on the
+-- stretched audio and what the output ended up at.
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS normalize_lufs numeric,
+  ADD COLUMN IF NOT EXISTS normalize_true_peak numeric,
+  ADD COLUMN IF NOT EXISTS measured_lufs numeric,
+  ADD COLUMN IF NOT EXISTS measured_true_peak numeric,
+  ADD COLUMN IF NOT EXISTS measured_lra numeric,
+  ADD COLUMN IF NOT EXISTS normalized_lufs numeric,
+  ADD COLUMN IF NOT EXISTS normalized_true_peak numeric,
+  ADD COLUMN IF NOT EXISTS normalization_type text;
+
+-- Per-user default
+ALTER TABLE user_settings
+  ADD COLUMN IF NOT EXISTS normalize boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS target_lufs numeric NOT NULL DEFAULT -14,
+  ADD COLUMN IF NOT EXISTS true_peak_dbtp numeric NOT NULL DEFAULT -1;
@@ -0,0 +1,3 @@
+-- Metronome overlay mixed into the render: {"sound","volume","every"}, NULL = none
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS click jsonb;
@@ -0,0 +1,11 @@
+-- Tempo ramp renders. render_mode says how the target tempo is given;
+-- segment_plan is the worker's source-to-output map (one entry per tempo).
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS render_mode text NOT NULL DEFAULT 'constant',
+  ADD COLUMN IF NOT EXISTS ramp jsonb,
+  ADD COLUMN IF NOT EXISTS segment_plan jsonb;
+
+ALTER TABLE render_jobs DROP CONSTRAINT IF EXISTS render_jobs_render_mode_chk;
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_render_mode_chk
+  CHECK (render_mode IN ('constant','ramp'));
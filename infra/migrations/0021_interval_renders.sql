@@ -0,0 +1,8 @@
+-- Interval workout renders: {"segments":[{"duration_sec","target_bpm"}],"repeat","transition_beats"}
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS intervals jsonb;
+
+ALTER TABLE render_jobs DROP CONSTRAINT IF EXISTS render_jobs_render_mode_chk;
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_render_mode_chk
+  CHECK (render_mode IN ('constant','ramp','intervals'));
@@ -0,0 +1,10 @@
+-- Render reuse: identical uploads share a source hash, and finished renders
+-- carry the key of everything that shaped them (see shared/rendercache)
+ALTER TABLE tracks
+  ADD COLUMN IF NOT EXISTS source_sha256 text;
+
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS cache_key text;
+
+CREATE INDEX IF NOT EXISTS render_jobs_cache_key_idx
+  ON render_jobs(cache_key) WHERE status = 'done';
@@ -0,0 +1,11 @@
+-- Users can cancel analysis and render jobs that haven't finished;
+-- finished_at records when.
+ALTER TABLE track_analysis DROP CONSTRAINT IF EXISTS track_analysis_status_chk;
+ALTER TABLE track_analysis
+  ADD CONSTRAINT track_analysis_status_chk
+  CHECK (status IN ('queued','running','done','failed','canceled'));
+
+ALTER TABLE render_jobs DROP CONSTRAINT IF EXISTS render_jobs_status_chk;
+ALTER TABLE render_jobs
+  ADD CONSTRAINT render_jobs_status_chk
+  CHECK (status IN ('waiting','queued','running','done','failed','canceled'));
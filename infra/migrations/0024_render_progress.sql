@@ -0,0 +1,7 @@
+-- Live render progress, written by the worker every couple of seconds:
+-- fraction done (0..1), the stage it's in and an estimate of seconds left
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS progress real,
+  ADD COLUMN IF NOT EXISTS progress_stage text,
+  ADD COLUMN IF NOT EXISTS eta_sec integer,
+  ADD COLUMN IF NOT EXISTS progress_at timestamptz;
@@ -0,0 +1,4 @@
+-- The candidate's BPM as of the request. tempo_candidate is an index into
+-- the analysis that was current then; a re-analysis reorders the list.
+ALTER TABLE render_jobs
+  ADD COLUMN IF NOT EXISTS tempo_candidate_bpm numeric;
@@ -0,0 +1,251 @@
+// Package audiofixture generates WAV audio with known properties (click
+// tracks at a given tempo, ramps, swing, padding, noise) so analysis and
+// rendering can be exercised without committing real recordings.
+package audiofixture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// Spec describes a clip. Zero values get sensible defaults (see Generate).
+type Spec struct {
+	SampleRate int // Hz; default 44100
+	Channels   int // 1 or 2; default 1
+
+	Duration float64 // seconds of clicks, not counting padding
+	BPM      float64 // tempo at the start
+	EndBPM   float64 // if set, tempo ramps linearly from BPM to EndBPM over Duration
+
+	// Swing delays every second click by this fraction of the beat interval
+	// (0 = straight, ~0.33 = triplet feel).
+	Swing float64
+
+	LeadSilence float64 // seconds of silence before the first click
+	TailSilence float64 // seconds of silence after Duration
+
+	AccentEvery int     // every Nth click is a louder, higher downbeat; 0 = no accents
+	ClickHz     float64 // click pitch; default 1000
+	ClickSec    float64 // click length; default 0.03
+	Amplitude   float64 // click peak, 0..1; default 0.8
+
+	NoiseLevel float64 // white noise amplitude over the whole clip, 0..1
+	Seed       int64   // noise seed, for reproducible fixtures
+
+	// Pan alternates clicks left/right by this amount (0..1) on stereo clips.
+	Pan float64
+}
+
+// Clip is generated audio plus the ground truth it was built from.
+type Clip struct {
+	SampleRate int
+	Channels   int
+	Samples    [][]float32 // [channel][frame], in [-1, 1]
+	Beats      []float64   // click onset times in seconds
+	Downbeats  []float64   // accented click times (when AccentEvery > 0)
+}
+
+// Duration returns the clip length in seconds.
+func (c *Clip) Duration() float64 {
+	if len(c.Samples) == 0 {
+		return 0
+	}
+	return float64(len(c.Samples[0])) / float64(c.SampleRate)
+}
+
+// ClickTrack is a mono 44.1 kHz click track at a fixed tempo.
+func ClickTrack(bpm, seconds float64) (*Clip, error) {
+	return Generate(Spec{BPM: bpm, Duration: seconds})
+}
+
+// Generate renders the clip described by spec.
+func Generate(spec Spec) (*Clip, error) {
+	if spec.SampleRate == 0 {
+		spec.SampleRate = 44100
+	}
+	if spec.Channels == 0 {
+		spec.Channels = 1
+	}
+	if spec.ClickHz == 0 {
+		spec.ClickHz = 1000
+	}
+	if spec.ClickSec == 0 {
+		spec.ClickSec = 0.03
+	}
+	if spec.Amplitude == 0 {
+		spec.Amplitude = 0.8
+	}
+	if spec.EndBPM == 0 {
+		spec.EndBPM = spec.BPM
+	}
+
+	switch {
+	case spec.SampleRate < 8000 || spec.SampleRate > 192000:
+		return nil, errors.New("audiofixture: sample rate out of range")
+	case spec.Channels != 1 && spec.Channels != 2:
+		return nil, errors.New("audiofixture: channels must be 1 or 2")
+	case spec.BPM <= 0 || spec.EndBPM <= 0:
+		return nil, errors.New("audiofixture: BPM must be positive")
+	case spec.Duration <= 0:
+		return nil, errors.New("audiofixture: duration must be positive")
+	case spec.Swing < 0 || spec.Swing >= 1:
+		return nil, errors.New("audiofixture: swing must be in [0, 1)")
+	}
+
+	sr := float64(spec.SampleRate)
+	total := int(math.Round((spec.LeadSilence + spec.Duration + spec.TailSilence) * sr))
+	c := &Clip{SampleRate: spec.SampleRate, Channels: spec.Channels, Samples: make([][]float32, spec.Channels)}
+	for ch := range c.Samples {
+		c.Samples[ch] = make([]float32, total)
+	}
+
+	times := beatTimes(spec)
+	for i, t := range times {
+		if i%2 == 1 && spec.Swing > 0 {
+			next := spec.Duration
+			if i+1 < len(times) {
+				next = times[i+1]
+			}
+			t += spec.Swing * (next - t)
+		}
+		at := spec.LeadSilence + t
+
+		accent := spec.AccentEvery > 0 && i%spec.AccentEvery == 0
+		amp, hz := spec.Amplitude*0.6, spec.ClickHz
+		if accent || spec.AccentEvery == 0 {
+			amp = spec.Amplitude
+		}
+		if accent {
+			hz *= 1.5
+			c.Downbeats = append(c.Downbeats, at)
+		}
+		c.Beats = append(c.Beats, at)
+
+		gains := []float64{1}
+		if spec.Channels == 2 {
+			p := spec.Pan
+			if i%2 == 1 {
+				p = -p
+			}
+			// constant-power pan, p in [-1, 1], scaled so the louder side
+			// peaks at Amplitude (centre is Amplitude on both)
+			angle := (p + 1) * math.Pi / 4
+			l, r := math.Cos(angle), math.Sin(angle)
+			loud := math.Max(l, r)
+			gains = []float64{l / loud, r / loud}
+		}
+		addClick(c.Samples, int(math.Round(at*sr)), sr, hz, spec.ClickSec, amp, gains)
+	}
+
+	if spec.NoiseLevel > 0 {
+		rng := rand.New(rand.NewSource(spec.Seed))
+		for ch := range c.Samples {
+			for i := range c.Samples[ch] {
+				c.Samples[ch][i] += float32((rng.Float64()*2 - 1) * spec.NoiseLevel)
+			}
+		}
+	}
+
+	for ch := range c.Samples {
+		for i, v := range c.Samples[ch] {
+			c.Samples[ch][i] = float32(math.Max(-1, math.Min(1, float64(v))))
+		}
+	}
+	return c, nil
+}
+
+// beatTimes places beats for a tempo ramping linearly in time from BPM to
+// EndBPM: beat k falls where the integrated tempo reaches k beats.
+func beatTimes(spec Spec) []float64 {
+	b := spec.BPM / 60
+	a := (spec.EndBPM - spec.BPM) / (120 * spec.Duration) // d(beats/s)/dt / 2
+	var out []float64
+	for k := 0; ; k++ {
+		var t float64
+		if a == 0 {
+			t = float64(k) / b
+		} else {
+			t = (-b + math.Sqrt(b*b+4*a*float64(k))) / (2 * a)
+		}
+		if math.IsNaN(t) || t >= spec.Duration {
+			return out
+		}
+		out = append(out, t)
+	}
+}
+
+// addClick mixes in a decaying sine burst starting at frame start.
+func addClick(dst [][]float32, start int, sr, hz, length, amp float64, gains []float64) {
+	n := int(length * sr)
+	for j := 0; j < n; j++ {
+		i := start + j
+		if i < 0 || i >= len(dst[0]) {
+			continue
+		}
+		t := float64(j) / sr
+		v := amp * math.Sin(2*math.Pi*hz*t) * math.Exp(-t/(length/5))
+		for ch := range dst {
+			dst[ch][i] += float32(v * gains[ch])
+		}
+	}
+}
+
+// WriteWAV encodes the clip as 16-bit PCM WAV, clipping samples outside
+// [-1, 1].
+func (c *Clip) WriteWAV(w io.Writer) error {
+	frames := 0
+	if len(c.Samples) > 0 {
+		frames = len(c.Samples[0])
+	}
+	dataSize := frames * c.Channels * 2
+
+	bw := bufio.NewWriter(w)
+	le := binary.LittleEndian
+	hdr := make([]byte, 44)
+	copy(hdr[0:], "RIFF")
+	le.PutUint32(hdr[4:], uint32(36+dataSize))
+	copy(hdr[8:], "WAVE")
+	copy(hdr[12:], "fmt ")
+	le.PutUint32(hdr[16:], 16)
+	le.PutUint16(hdr[20:], 1) // PCM
+	le.PutUint16(hdr[22:], uint16(c.Channels))
+	le.PutUint32(hdr[24:], uint32(c.SampleRate))
+	le.PutUint32(hdr[28:], uint32(c.SampleRate*c.Channels*2))
+	le.PutUint16(hdr[32:], uint16(c.Channels*2))
+	le.PutUint16(hdr[34:], 16)
+	copy(hdr[36:], "data")
+	le.PutUint32(hdr[40:], uint32(dataSize))
+	if _, err := bw.Write(hdr); err != nil {
+		return err
+	}
+
+	var buf [2]byte
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < c.Channels; ch++ {
+			v := math.Max(-1, math.Min(1, float64(c.Samples[ch][i])))
+			le.PutUint16(buf[:], uint16(int16(math.Round(v*32767))))
+			if _, err := bw.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the clip as a WAV file at path.
+func (c *Clip) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteWAV(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
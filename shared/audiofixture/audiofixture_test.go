@@ -0,0 +1,85 @@
+package audiofixture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/tempo"
+)
+
+func TestClickTrackTempo(t *testing.T) {
+	for _, bpm := range []float64{90, 128, 174} {
+		clip, err := ClickTrack(bpm, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, conf, ok := tempo.BPMAndConfidenceFromBeats(clip.Beats)
+		if !ok || math.Abs(got-bpm) > 0.5 {
+			t.Errorf("bpm %v: got %v (ok=%v)", bpm, got, ok)
+		}
+		if conf < 0.95 {
+			t.Errorf("bpm %v: confidence %v on a metronome", bpm, conf)
+		}
+	}
+}
+
+func TestStereoPanPeak(t *testing.T) {
+	for _, pan := range []float64{0, 0.5, 1} {
+		clip, err := Generate(Spec{Channels: 2, BPM: 120, Duration: 4, Pan: pan, Amplitude: 0.8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var peak float64
+		for _, ch := range clip.Samples {
+			for _, v := range ch {
+				peak = math.Max(peak, math.Abs(float64(v)))
+			}
+		}
+		if peak > 0.8+1e-6 || peak < 0.7 {
+			t.Errorf("pan %v: peak %v, want about 0.8", pan, peak)
+		}
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	clip, err := Generate(Spec{SampleRate: 48000, Channels: 2, BPM: 100, Duration: 2, LeadSilence: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := clip.WriteWAV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	frames := len(clip.Samples[0])
+	if len(b) != 44+frames*2*2 {
+		t.Fatalf("wav is %d bytes, want %d", len(b), 44+frames*4)
+	}
+	if sr := binary.LittleEndian.Uint32(b[24:]); sr != 48000 {
+		t.Errorf("sample rate %d", sr)
+	}
+	if ch := binary.LittleEndian.Uint16(b[22:]); ch != 2 {
+		t.Errorf("channels %d", ch)
+	}
+	if clip.Beats[0] < 0.5 {
+		t.Errorf("first beat %v inside the lead silence", clip.Beats[0])
+	}
+}
+
+// Overlapping clicks can sum past full scale; they must clip, not wrap.
+func TestWriteWAVClips(t *testing.T) {
+	clip := &Clip{SampleRate: 44100, Channels: 1, Samples: [][]float32{{0.5, 1.7, -2, 0}}}
+	var buf bytes.Buffer
+	if err := clip.WriteWAV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	pcm := buf.Bytes()[44:]
+	want := []int16{16384, 32767, -32767, 0}
+	for i, w := range want {
+		if got := int16(binary.LittleEndian.Uint16(pcm[2*i:])); got != w {
+			t.Errorf("sample %d = %d, want %d", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Package audioformat describes the output formats a render can be encoded
+// to: file extension, content type and the bitrates that make sense.
+package audioformat
+
+import "strings"
+
+type Format struct {
+	Name        string // canonical name stored on the render
+	Ext         string // object key extension, with the dot
+	ContentType string
+	Lossless    bool // no bitrate option
+
+	MinKbps, MaxKbps int
+	// DefaultKbps is used when the render doesn't ask for a bitrate; 0 means
+	// the encoder's VBR quality mode (mp3 only)
+	DefaultKbps int
+}
+
+// Default is the format of renders that don't ask for one.
+const Default = "mp3"
+
+var formats = map[string]Format{
+	"mp3":  {Name: "mp3", Ext: ".mp3", ContentType: "audio/mpeg", MinKbps: 32, MaxKbps: 320},
+	"m4a":  {Name: "m4a", Ext: ".m4a", ContentType: "audio/mp4", MinKbps: 32, MaxKbps: 320, DefaultKbps: 192},
+	"opus": {Name: "opus", Ext: ".opus", ContentType: "audio/ogg", MinKbps: 16, MaxKbps: 256, DefaultKbps: 128},
+	"flac": {Name: "flac", Ext: ".flac", ContentType: "audio/flac", Lossless: true},
+	"wav":  {Name: "wav", Ext: ".wav", ContentType: "audio/wav", Lossless: true},
+}
+
+var aliases = map[string]string{
+	"aac":  "m4a",
+	"mp4":  "m4a",
+	"ogg":  "opus",
+	"wave": "wav",
+}
+
+// Lookup resolves a format name (or alias such as "aac"), case-insensitively.
+func Lookup(name string) (Format, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if a, ok := aliases[name]; ok {
+		name = a
+	}
+	f, ok := formats[name]
+	return f, ok
+}
+
+// Names lists the canonical format names.
+func Names() []string {
+	return []string{"mp3", "m4a", "opus", "flac", "wav"}
+}
+
+// ValidBitrate reports whether kbps can be used with the format.
+func (f Format) ValidBitrate(kbps int) bool {
+	return !f.Lossless && kbps >= f.MinKbps && kbps <= f.MaxKbps
+}
@@ -0,0 +1,3 @@
+module github.com/JGrinovich/bpm-runner-app/shared
+
+go 1.24.5
@@ -0,0 +1,141 @@
+// Package rendercache derives the key under which a finished render can be
+// reused: everything that shapes its audio, so two renders with the same key
+// are interchangeable. The worker stores the key on each render it finishes
+// and the API looks it up before queuing a new one.
+package rendercache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/stretch"
+)
+
+// version changes whenever the worker's output for the same parameters
+// would, so older renders stop matching.
+const version = "1"
+
+// Params are a render's inputs. JSON options are compared by content, so
+// jsonb read back from Postgres matches what the API marshalled.
+type Params struct {
+	SourceSHA256 string  // hex sha256 of the uploaded source file
+	SourceBpm    float64 // the tempo stretched from (candidate, override or analysis)
+
+	// Beat grid and detected sections: the analysis run, and the override's
+	// beat offset. Only part of the key when the render uses them (tempo
+	// ramps, intervals, click, auto trim).
+	AnalysisID string
+	BeatOffset *float64
+
+	TargetBpm float64
+	Mode      string // "constant", "ramp", "intervals"
+	Ramp      json.RawMessage
+	Intervals json.RawMessage
+
+	Engine, Quality string // quality "" means the engine's default
+
+	Format      string
+	BitrateKbps int // 0 = the format's default
+	SampleRate  int // 0 = the source's
+
+	TrimMode          string
+	TrimStart         *float64
+	TrimEnd           *float64
+	NormalizeLUFS     *float64
+	NormalizeTruePeak *float64
+	Click             json.RawMessage
+}
+
+// UsesBeatGrid reports whether the output depends on the analysed beats or
+// sections, not just the source tempo.
+func (p Params) UsesBeatGrid() bool {
+	return (p.Mode != "" && p.Mode != "constant") || len(p.Click) > 0 || p.TrimMode == "auto"
+}
+
+// Key returns the cache key for p, or "" if the source hash is unknown.
+func Key(p Params) string {
+	if p.SourceSHA256 == "" {
+		return ""
+	}
+	if p.Mode == "" {
+		p.Mode = "constant"
+	}
+	if p.Quality == "" {
+		p.Quality = stretch.DefaultPreset(p.Engine)
+	}
+	if p.TrimMode == "" {
+		p.TrimMode = "none"
+	}
+	if !p.UsesBeatGrid() {
+		p.AnalysisID, p.BeatOffset = "", nil
+	}
+
+	b, _ := json.Marshal(map[string]any{
+		"v":           version,
+		"source":      p.SourceSHA256,
+		"source_bpm":  round(p.SourceBpm),
+		"analysis":    p.AnalysisID,
+		"beat_offset": roundPtr(p.BeatOffset),
+		"target_bpm":  round(p.TargetBpm),
+		"mode":        p.Mode,
+		"ramp":        canonical(p.Ramp),
+		"intervals":   canonical(p.Intervals),
+		"engine":      p.Engine,
+		"quality":     p.Quality,
+		"format":      p.Format,
+		"bitrate":     p.BitrateKbps,
+		"sample_rate": p.SampleRate,
+		"trim":        []any{p.TrimMode, roundPtr(p.TrimStart), roundPtr(p.TrimEnd)},
+		"normalize":   []any{roundPtr(p.NormalizeLUFS), roundPtr(p.NormalizeTruePeak)},
+		"click":       canonical(p.Click),
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonical decodes a JSON option so it re-encodes with sorted keys and no
+// formatting; nil and "null" are nil.
+func canonical(raw json.RawMessage) any {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	return roundAll(v)
+}
+
+// roundAll rounds every number in a decoded JSON value.
+func roundAll(v any) any {
+	switch x := v.(type) {
+	case float64:
+		return round(x)
+	case []any:
+		for i := range x {
+			x[i] = roundAll(x[i])
+		}
+	case map[string]any:
+		for k := range x {
+			x[k] = roundAll(x[k])
+		}
+	}
+	return v
+}
+
+// Postgres numeric and float64 round-trip with tiny differences; four
+// decimals is far below anything audible.
+func round(x float64) float64 {
+	return math.Round(x*1e4) / 1e4
+}
+
+func roundPtr(x *float64) any {
+	if x == nil {
+		return nil
+	}
+	return round(*x)
+}
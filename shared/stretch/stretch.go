@@ -0,0 +1,70 @@
+// Package stretch names the time-stretch engines a render can use and their
+// quality presets, so the API validates exactly what the worker implements.
+package stretch
+
+const (
+	// Atempo is ffmpeg's built-in WSOLA stretcher: always available, but
+	// chained atempo gets audibly phasey far from ratio 1.
+	Atempo = "atempo"
+	// Rubberband is the Rubber Band library (ffmpeg filter, or its CLI).
+	Rubberband = "rubberband"
+	// Resample plays the audio faster/slower, so pitch follows tempo.
+	Resample = "resample"
+)
+
+// presets lists each engine's quality presets; the first is the default.
+var presets = map[string][]string{
+	Atempo:     {"standard"},
+	Rubberband: {"balanced", "fast", "high", "percussive"},
+	Resample:   {"standard", "high"},
+}
+
+// Engines returns the engine names.
+func Engines() []string {
+	return []string{Atempo, Rubberband, Resample}
+}
+
+// Presets returns the engine's quality presets, default first, or nil for
+// an unknown engine.
+func Presets(engine string) []string {
+	return append([]string(nil), presets[engine]...)
+}
+
+// DefaultPreset is the preset used when a render doesn't pick one.
+func DefaultPreset(engine string) string {
+	if p := presets[engine]; len(p) > 0 {
+		return p[0]
+	}
+	return ""
+}
+
+// Valid reports whether engine is known and preset is one of its presets
+// (an empty preset means the default).
+func Valid(engine, preset string) bool {
+	p, ok := presets[engine]
+	if !ok {
+		return false
+	}
+	if preset == "" {
+		return true
+	}
+	for _, v := range p {
+		if v == preset {
+			return true
+		}
+	}
+	return false
+}
+
+// PreservesPitch reports whether the engine keeps pitch while changing tempo.
+func PreservesPitch(engine string) bool {
+	return engine != Resample
+}
+
+// Default is the engine for renders that only say whether to keep pitch.
+func Default(preservePitch bool) string {
+	if preservePitch {
+		return Atempo
+	}
+	return Resample
+}
@@ -0,0 +1,93 @@
+// Package tempo holds the beat-timing math shared by the API (tap tempo)
+// and the worker (analysis).
+package tempo
+
+import (
+	"math"
+	"sort"
+)
+
+// BPMAndConfidenceFromBeats estimates tempo from a list of beat (or tap)
+// times in seconds: BPM from the median inter-beat interval, confidence
+// from how tightly the intervals cluster around it (1 - MAD/median).
+func BPMAndConfidenceFromBeats(beats []float64) (bpm float64, confidence float64, ok bool) {
+	if len(beats) < 8 {
+		return 0, 0, false
+	}
+
+	var intervals []float64
+	for i := 1; i < len(beats); i++ {
+		d := beats[i] - beats[i-1]
+		if d > 0.2 && d < 2.0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) < 6 {
+		return 0, 0, false
+	}
+
+	sort.Float64s(intervals)
+	med := median(intervals)
+	if med <= 0 {
+		return 0, 0, false
+	}
+	bpm = 60.0 / med
+
+	var absDev []float64
+	for _, d := range intervals {
+		absDev = append(absDev, math.Abs(d-med))
+	}
+	sort.Float64s(absDev)
+	mad := median(absDev)
+
+	confidence = 1.0 - (mad / med)
+	confidence = clamp(confidence, 0, 1)
+
+	return bpm, confidence, true
+}
+
+// BeatOffset returns where the beat grid starts within the first beat
+// period: the median phase of the beats modulo 60/bpm.
+func BeatOffset(beats []float64, bpm float64) float64 {
+	if len(beats) == 0 || bpm <= 0 {
+		return 0
+	}
+	period := 60.0 / bpm
+	ref := beats[0]
+	var shifts []float64
+	for _, b := range beats {
+		// Phase relative to the first beat, wrapped to (-period/2, period/2]
+		d := math.Mod(b-ref, period)
+		if d > period/2 {
+			d -= period
+		}
+		shifts = append(shifts, d)
+	}
+	sort.Float64s(shifts)
+	off := math.Mod(ref+median(shifts), period)
+	if off < 0 {
+		off += period
+	}
+	return off
+}
+
+func median(a []float64) float64 {
+	n := len(a)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return a[n/2]
+	}
+	return (a[n/2-1] + a[n/2]) / 2
+}
+
+func clamp(x, lo, hi float64) float64 {
+	if x < lo {
+		return lo
+	}
+	if x > hi {
+		return hi
+	}
+	return x
+}
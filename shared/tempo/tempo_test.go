@@ -0,0 +1,34 @@
+package tempo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/audiofixture"
+)
+
+// Tap tempo on taps that follow a fixture's beats with human timing error.
+func TestTapTempoFromFixtureBeats(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, bpm := range []float64{85, 170, 180} {
+		clip, err := audiofixture.ClickTrack(bpm, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		taps := make([]float64, len(clip.Beats))
+		for i, b := range clip.Beats {
+			taps[i] = b + (rng.Float64()*2-1)*0.01
+		}
+		got, conf, ok := BPMAndConfidenceFromBeats(taps)
+		if !ok {
+			t.Fatalf("bpm %v: no estimate from %d taps", bpm, len(taps))
+		}
+		if math.Abs(got-bpm) > 0.02*bpm {
+			t.Errorf("bpm %v: tapped %v", bpm, got)
+		}
+		if conf < 0.8 {
+			t.Errorf("bpm %v: confidence %v for steady taps", bpm, conf)
+		}
+	}
+}
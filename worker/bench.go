@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/audiofixture"
+)
+
+// Octave relations accepted by Acc2 (MIREX convention)
+var acc2Factors = []float64{1, 2, 0.5, 3, 1.0 / 3}
+
+type benchItem struct {
+	File     string
+	RefBpm   float64
+	EstBpm   float64
+	Conf     float64
+	Acc1     bool
+	Acc2     bool
+	CandHit  bool // some tempo candidate is within tolerance
+	Err      error
+	Duration time.Duration
+}
+
+// runBench implements `worker bench`: run the analysis pipeline over a
+// labeled corpus and report tempo accuracy. Returns the process exit code;
+// non-zero when the run fails or misses the -min-acc1/-min-acc2 gates.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory holding the audio files")
+	labels := fs.String("labels", "", "CSV of file,bpm ground truth (file relative to -dir)")
+	tolerance := fs.Float64("tolerance", 0.04, "relative BPM tolerance for a hit")
+	out := fs.String("out", "", "optional per-file CSV report path")
+	minAcc1 := fs.Float64("min-acc1", 0, "fail if Acc1 is below this (0..1)")
+	minAcc2 := fs.Float64("min-acc2", 0, "fail if Acc2 is below this (0..1)")
+	timeout := fs.Duration("timeout", 6*time.Minute, "per-file analysis timeout")
+	synthetic := fs.Bool("synthetic", false, "benchmark generated click-track fixtures instead of -dir/-labels")
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var refs []benchLabel
+	var err error
+	switch {
+	case *synthetic:
+		tmp, terr := os.MkdirTemp("", "bpmbench-fixtures-*")
+		if terr != nil {
+			fmt.Fprintf(os.Stderr, "bench: %v\n", terr)
+			return 1
+		}
+		defer os.RemoveAll(tmp)
+		*dir = tmp
+		refs, err = writeSyntheticCorpus(tmp)
+	case *dir == "" || *labels == "":
+		fmt.Fprintln(os.Stderr, "usage: worker bench (-dir <audio dir> -labels <labels.csv> | -synthetic) [-tolerance 0.04] [-out report.csv] [-min-acc1 x] [-min-acc2 x]")
+		return 2
+	default:
+		refs, err = readBenchLabels(*labels)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+		return 2
+	}
+
+	items := make([]benchItem, 0, len(refs))
+	for i, ref := range refs {
+		it := benchOne(filepath.Join(*dir, ref.File), ref.Bpm, *tolerance, *timeout)
+		it.File = ref.File
+		items = append(items, it)
+		status := fmt.Sprintf("est=%.2f conf=%.2f", it.EstBpm, it.Conf)
+		if it.Err != nil {
+			status = "error: " + firstLine(it.Err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s ref=%.2f %s (%s)\n", i+1, len(refs), ref.File, ref.Bpm, status, it.Duration.Round(time.Millisecond))
+	}
+
+	acc1, acc2 := printBenchReport(os.Stdout, items, *tolerance)
+
+	if *out != "" {
+		if err := writeBenchCSV(*out, items); err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+			return 1
+		}
+	}
+
+	if acc1 < *minAcc1 || acc2 < *minAcc2 {
+		fmt.Fprintf(os.Stderr, "bench: FAILED gate (acc1 %.3f / min %.3f, acc2 %.3f / min %.3f)\n", acc1, *minAcc1, acc2, *minAcc2)
+		return 1
+	}
+	return 0
+}
+
+func benchOne(path string, refBpm, tolerance float64, timeout time.Duration) benchItem {
+	it := benchItem{RefBpm: refBpm}
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tmpDir, err := os.MkdirTemp("", "bpmbench-*")
+	if err != nil {
+		it.Err = err
+		return it
+	}
+	defer os.RemoveAll(tmpDir)
+
+	res, err := analyzeAudio(ctx, path, tmpDir)
+	it.Duration = time.Since(start)
+	if err != nil {
+		it.Err = err
+		return it
+	}
+
+	it.EstBpm = res.Bpm
+	it.Conf = res.Confidence
+	it.Acc1 = withinTolerance(res.Bpm, refBpm, tolerance)
+	for _, f := range acc2Factors {
+		if withinTolerance(res.Bpm, refBpm*f, tolerance) {
+			it.Acc2 = true
+		}
+	}
+	for _, c := range res.Candidates {
+		if withinTolerance(c.Bpm, refBpm, tolerance) {
+			it.CandHit = true
+		}
+	}
+	return it
+}
+
+func withinTolerance(est, ref, tolerance float64) bool {
+	return ref > 0 && math.Abs(est-ref) <= tolerance*ref
+}
+
+type benchLabel struct {
+	File string
+	Bpm  float64
+}
+
+// syntheticCorpus covers the running tempo range plus the usual trouble
+// spots: slow songs (octave errors), swing, noise, stereo, other sample
+// rates, long silent intros and gradual tempo drift.
+var syntheticCorpus = []struct {
+	Name string
+	Spec audiofixture.Spec
+}{
+	{"click_090.wav", audiofixture.Spec{BPM: 90}},
+	{"click_120.wav", audiofixture.Spec{BPM: 120, AccentEvery: 4}},
+	{"click_128_stereo_48k.wav", audiofixture.Spec{BPM: 128, Channels: 2, SampleRate: 48000, Pan: 0.5}},
+	{"click_150_waltz.wav", audiofixture.Spec{BPM: 150, AccentEvery: 3}},
+	{"click_165_swing.wav", audiofixture.Spec{BPM: 165, Swing: 0.2}},
+	{"click_172_noise.wav", audiofixture.Spec{BPM: 172, NoiseLevel: 0.05, Seed: 1}},
+	{"click_180_22k.wav", audiofixture.Spec{BPM: 180, SampleRate: 22050}},
+	{"click_176_padded.wav", audiofixture.Spec{BPM: 176, LeadSilence: 20, TailSilence: 15}},
+	{"click_drift_160_164.wav", audiofixture.Spec{BPM: 160, EndBPM: 164}},
+}
+
+// writeSyntheticCorpus renders syntheticCorpus into dir and returns its
+// labels. Ramps are labeled with their tempo in the analysis window.
+func writeSyntheticCorpus(dir string) ([]benchLabel, error) {
+	const seconds = 150 // comfortably covers the analysis window
+	var out []benchLabel
+	for _, f := range syntheticCorpus {
+		spec := f.Spec
+		spec.Duration = seconds
+		clip, err := audiofixture.Generate(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if err := clip.WriteFile(filepath.Join(dir, f.Name)); err != nil {
+			return nil, err
+		}
+
+		ref := spec.BPM
+		if spec.EndBPM != 0 {
+			mid := analysisWindowStart + analysisWindowLen/2 - spec.LeadSilence
+			ref = spec.BPM + (spec.EndBPM-spec.BPM)*mid/seconds
+		}
+		out = append(out, benchLabel{File: f.Name, Bpm: ref})
+	}
+	return out, nil
+}
+
+// readBenchLabels reads "file,bpm" rows; a header row is skipped.
+func readBenchLabels(path string) ([]benchLabel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	var out []benchLabel
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("%s:%d: want file,bpm", path, line)
+		}
+		bpm, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("%s:%d: bad bpm %q", path, line, rec[1])
+		}
+		out = append(out, benchLabel{File: strings.TrimSpace(rec[0]), Bpm: bpm})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no labeled files", path)
+	}
+	return out, nil
+}
+
+// printBenchReport prints accuracy, confidence calibration and the per-file
+// table, and returns (acc1, acc2) over all files (errors count as misses).
+func printBenchReport(w io.Writer, items []benchItem, tolerance float64) (float64, float64) {
+	n := len(items)
+	var nAcc1, nAcc2, nCand, nErr int
+	for _, it := range items {
+		if it.Err != nil {
+			nErr++
+		}
+		if it.Acc1 {
+			nAcc1++
+		}
+		if it.Acc2 {
+			nAcc2++
+		}
+		if it.CandHit {
+			nCand++
+		}
+	}
+	acc1 := float64(nAcc1) / float64(n)
+	acc2 := float64(nAcc2) / float64(n)
+
+	fmt.Fprintf(w, "analysis %s v%s — %d files, tolerance ±%.1f%%\n\n", analysisAlgorithm, analysisVersion, n, tolerance*100)
+	fmt.Fprintf(w, "Acc1            %6.1f%%  (%d/%d)\n", acc1*100, nAcc1, n)
+	fmt.Fprintf(w, "Acc2            %6.1f%%  (%d/%d, octave errors x2 x1/2 x3 x1/3 allowed)\n", acc2*100, nAcc2, n)
+	fmt.Fprintf(w, "Candidate hit   %6.1f%%  (%d/%d, correct BPM among tempo candidates)\n", float64(nCand)/float64(n)*100, nCand, n)
+	fmt.Fprintf(w, "Errors          %6d\n\n", nErr)
+
+	// Calibration: is "confidence" a good predictor of Acc1?
+	const bins = 5
+	var count [bins]int
+	var confSum, hitSum [bins]float64
+	for _, it := range items {
+		if it.Err != nil {
+			continue
+		}
+		b := int(it.Conf * bins)
+		if b >= bins {
+			b = bins - 1
+		}
+		count[b]++
+		confSum[b] += it.Conf
+		if it.Acc1 {
+			hitSum[b]++
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "confidence\tfiles\tmean conf\tAcc1\t")
+	var ece float64
+	var scored int
+	for b := 0; b < bins; b++ {
+		scored += count[b]
+	}
+	for b := 0; b < bins; b++ {
+		label := fmt.Sprintf("%.1f-%.1f", float64(b)/bins, float64(b+1)/bins)
+		if count[b] == 0 {
+			fmt.Fprintf(tw, "%s\t0\t-\t-\t\n", label)
+			continue
+		}
+		meanConf := confSum[b] / float64(count[b])
+		binAcc := hitSum[b] / float64(count[b])
+		ece += float64(count[b]) / float64(scored) * math.Abs(binAcc-meanConf)
+		fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.1f%%\t\n", label, count[b], meanConf, binAcc*100)
+	}
+	_ = tw.Flush()
+	if scored > 0 {
+		fmt.Fprintf(w, "expected calibration error: %.3f\n", ece)
+	}
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "file\tref\test\tconf\terr%\tacc1\tacc2\tcand\t")
+	for _, it := range items {
+		if it.Err != nil {
+			fmt.Fprintf(tw, "%s\t%.2f\t-\t-\t-\tno\tno\tno\t%s\n", it.File, it.RefBpm, firstLine(it.Err.Error()))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%+.1f\t%s\t%s\t%s\t\n",
+			it.File, it.RefBpm, it.EstBpm, it.Conf, (it.EstBpm-it.RefBpm)/it.RefBpm*100,
+			yesNo(it.Acc1), yesNo(it.Acc2), yesNo(it.CandHit))
+	}
+	_ = tw.Flush()
+
+	return acc1, acc2
+}
+
+func writeBenchCSV(path string, items []benchItem) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cw := csv.NewWriter(f)
+	_ = cw.Write([]string{"file", "ref_bpm", "est_bpm", "confidence", "error_pct", "acc1", "acc2", "candidate_hit", "seconds", "error"})
+	for _, it := range items {
+		row := []string{it.File, fmtFloat(it.RefBpm), "", "", "", yesNo(it.Acc1), yesNo(it.Acc2), yesNo(it.CandHit),
+			fmtFloat(it.Duration.Seconds()), ""}
+		if it.Err != nil {
+			row[9] = firstLine(it.Err.Error())
+		} else {
+			row[2], row[3] = fmtFloat(it.EstBpm), fmtFloat(it.Conf)
+			row[4] = fmtFloat((it.EstBpm - it.RefBpm) / it.RefBpm * 100)
+		}
+		_ = cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func fmtFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
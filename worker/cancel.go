@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/JGrinovich/bpm-runner-app/worker/internal/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// errJobCanceled is the cause of a job context canceled by the user.
+var errJobCanceled = errors.New("job canceled")
+
+// How often a running job's row is checked for a cancel request
+const cancelPollInterval = 2 * time.Second
+
+// watchCancel returns a context that is canceled with errJobCanceled once
+// the job's row (table is "track_analysis" or "render_jobs") says
+// 'canceled'. Canceling it kills any ffmpeg/aubio still running. stop ends
+// the watch.
+func watchCancel(ctx context.Context, pool *pgxpool.Pool, table, id string) (jobCtx context.Context, stop func()) {
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(cancelPollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-jobCtx.Done():
+				return
+			case <-t.C:
+			}
+			var status string
+			if err := pool.QueryRow(jobCtx, `SELECT status FROM `+table+` WHERE id=$1`, id).Scan(&status); err != nil {
+				continue
+			}
+			if status == "canceled" {
+				cancel(errJobCanceled)
+				return
+			}
+		}
+	}()
+	return jobCtx, func() {
+		close(done)
+		cancel(nil)
+	}
+}
+
+// jobCanceled reports whether the job stopped because the user canceled it.
+func jobCanceled(ctx context.Context, err error) bool {
+	return errors.Is(err, errJobCanceled) || errors.Is(context.Cause(ctx), errJobCanceled)
+}
+
+// deleteUploads removes objects a job uploaded before it failed or was
+// canceled. The job's context is done by then, so this gets its own.
+func deleteUploads(r2c *storage.R2Client, keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, key := range keys {
+		if err := r2c.Delete(ctx, key); err != nil {
+			log.Printf("cleanup: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// tempoCandidate is one reading of the track's tempo. The analysis picks
+// one, but octave errors are common and for running a half-time reading
+// (85 BPM -> 170) is often the useful one, so all of them are kept.
+type tempoCandidate struct {
+	Bpm      float64  `json:"bpm"`
+	Score    float64  `json:"score"`   // 0..1, higher = better supported
+	Sources  []string `json:"sources"` // estimators that produced it
+	Octave   string   `json:"octave"`  // relation to the source estimate: "x1", "x2", "x0.5"
+	Selected bool     `json:"selected"`
+}
+
+var octaveFactors = []struct {
+	Label  string
+	Factor float64
+}{
+	{"x1", 1},
+	{"x2", 2},
+	{"x0.5", 0.5},
+}
+
+// rankTempoCandidates lists the octave variants of both estimators. Each
+// beat-interval variant is scored by its distance to aubio's tempo (the same
+// rule chooseBestTempo uses); aubio variants that don't coincide with one of
+// those are scored against the beat estimate at half weight, since aubio's
+// whole-excerpt tempo is the less reliable of the two. The selected candidate
+// (the one chosen came from) comes first, the rest by score; it carries
+// final, the BPM the analysis stores after clamping.
+func rankTempoCandidates(beatBpm, tempoBpm, chosen, final float64) []tempoCandidate {
+	var out []tempoCandidate
+
+	for _, o := range octaveFactors {
+		c := beatBpm * o.Factor
+		out = append(out, tempoCandidate{
+			Bpm:      c,
+			Score:    1 / (1 + tempoDistance(c, tempoBpm)/10),
+			Sources:  []string{"beat_interval"},
+			Octave:   o.Label,
+			Selected: c == chosen,
+		})
+	}
+
+	if tempoBpm > 0 {
+	aubio:
+		for _, o := range octaveFactors {
+			c := tempoBpm * o.Factor
+			for i := range out {
+				if math.Abs(out[i].Bpm-c) <= out[i].Bpm*0.02 {
+					out[i].Sources = append(out[i].Sources, "aubio_tempo")
+					continue aubio
+				}
+			}
+			out = append(out, tempoCandidate{
+				Bpm:     c,
+				Score:   0.5 / (1 + tempoDistance(c, beatBpm)/10),
+				Sources: []string{"aubio_tempo"},
+				Octave:  o.Label,
+			})
+		}
+	}
+
+	for i := range out {
+		out[i].Bpm = math.Round(out[i].Bpm*100) / 100
+		out[i].Score = math.Round(out[i].Score*1000) / 1000
+		if out[i].Selected {
+			out[i].Bpm = final
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Selected != out[j].Selected {
+			return out[i].Selected
+		}
+		return out[i].Score > out[j].Score
+	})
+	return out
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/audiofixture"
+	"github.com/JGrinovich/bpm-runner-app/shared/tempo"
+)
+
+// clickOptions is the render's metronome overlay, as stored on the job.
+type clickOptions struct {
+	Sound  string  `json:"sound"`  // see clickSounds
+	Volume float64 `json:"volume"` // 0..1, peak level of the click
+	Every  string  `json:"every"`  // "beat", or "step": also on the off-beat, for songs at half the running cadence
+}
+
+// clickSounds synthesize one click at sample rate sr, peak 1.
+var clickSounds = map[string]func(sr float64) []float32{
+	// short high sine blip, the classic metronome
+	"click": func(sr float64) []float32 {
+		return decayingSines(sr, 0.02, 0.004, []float64{2000}, []float64{1})
+	},
+	// woodblock-ish: two inharmonic partials, quick decay
+	"wood": func(sr float64) []float32 {
+		return decayingSines(sr, 0.05, 0.01, []float64{850, 1620}, []float64{0.7, 0.3})
+	},
+	// sustained electronic beep
+	"beep": func(sr float64) []float32 {
+		return decayingSines(sr, 0.07, 1, []float64{880}, []float64{1})
+	},
+	// noise burst, cuts through busy mixes without a pitch
+	"tick": func(sr float64) []float32 {
+		n := int(0.012 * sr)
+		rng := rand.New(rand.NewSource(1))
+		out := make([]float32, n)
+		prev := 0.0
+		for i := range out {
+			v := rng.Float64()*2 - 1
+			// first difference = crude high-pass
+			out[i] = float32((v - prev) / 2 * math.Exp(-float64(i)/sr/0.003))
+			prev = v
+		}
+		return out
+	},
+}
+
+// decayingSines sums partials with an exponential decay (time constant tau)
+// and a 1 ms fade-in/out so the click doesn't pop.
+func decayingSines(sr, length, tau float64, hz, gains []float64) []float32 {
+	n := int(length * sr)
+	fade := int(0.001 * sr)
+	out := make([]float32, n)
+	for i := range out {
+		t := float64(i) / sr
+		var v float64
+		for k, f := range hz {
+			v += gains[k] * math.Sin(2*math.Pi*f*t)
+		}
+		v *= math.Exp(-t / tau)
+		if i < fade {
+			v *= float64(i) / float64(fade)
+		}
+		if n-i < fade {
+			v *= float64(n-i) / float64(fade)
+		}
+		out[i] = float32(v)
+	}
+	return out
+}
+
+// sourceBeatGrid returns the beats (source timeline, seconds) the click
+// follows. Analysis beats are used as detected when the render's tempo came
+// from that analysis; an override or tempo candidate gets a regular grid at
+// its BPM, phased by the override's offset or else the analysis beats.
+func sourceBeatGrid(analysisBeats []float64, bpm float64, origin string, overrideOffset *float64, duration float64) []float64 {
+	if origin == "analysis" && len(analysisBeats) > 0 {
+		return analysisBeats
+	}
+	offset := tempo.BeatOffset(analysisBeats, bpm)
+	if origin == "override" && overrideOffset != nil {
+		offset = *overrideOffset
+	}
+	period := 60 / bpm
+	var beats []float64
+	for t := offset; t < duration; t += period {
+		beats = append(beats, t)
+	}
+	return beats
+}
+
+// clickTimes maps source beats onto the render's timeline through its
+// segment plan; beats the plan doesn't cover (trimmed) are dropped. "step"
+// adds a click halfway between beats.
+func clickTimes(beats []float64, plan []renderSegment, every string) []float64 {
+	var out []float64
+	for _, b := range beats {
+		if t, ok := mapToOutput(plan, b); ok {
+			out = append(out, t)
+		}
+	}
+	if every == "step" && len(out) > 1 {
+		// Only split regular gaps; across a dropout there's no beat to halve
+		n := len(out)
+		gaps := make([]float64, 0, n-1)
+		for i := 0; i+1 < n; i++ {
+			gaps = append(gaps, out[i+1]-out[i])
+		}
+		sort.Float64s(gaps)
+		limit := 1.5 * median(gaps)
+		for i := 0; i+1 < n; i++ {
+			if out[i+1]-out[i] < limit {
+				out = append(out, (out[i]+out[i+1])/2)
+			}
+		}
+		sort.Float64s(out)
+	}
+	return out
+}
+
+// writeClickTrack renders the clicks at times into a WAV matching the
+// music's sample rate and channel count, so it can be mixed sample-exact.
+func writeClickTrack(path string, times []float64, opts clickOptions, sampleRate, channels int) error {
+	synth, ok := clickSounds[opts.Sound]
+	if !ok {
+		return fmt.Errorf("unknown click sound %q", opts.Sound)
+	}
+	if channels < 1 {
+		channels = 1
+	}
+	sr := float64(sampleRate)
+	click := synth(sr)
+
+	length := len(click)
+	if len(times) > 0 {
+		length += int(times[len(times)-1] * sr)
+	}
+	mono := make([]float32, length)
+	for _, t := range times {
+		start := int(math.Round(t * sr))
+		for j, v := range click {
+			if i := start + j; i >= 0 && i < len(mono) {
+				mono[i] += v * float32(opts.Volume)
+			}
+		}
+	}
+
+	samples := make([][]float32, channels)
+	for ch := range samples {
+		samples[ch] = mono
+	}
+	clip := &audiofixture.Clip{SampleRate: sampleRate, Channels: channels, Samples: samples}
+	return clip.WriteFile(path)
+}
+
+// mixClick lays the click track over the music; the music's length wins and
+// levels are summed as-is (no amix auto-attenuation).
+func mixClick(ctx context.Context, music, click, out string) error {
+	if _, err := runFFmpeg(ctx, "-y", "-i", music, "-i", click,
+		"-filter_complex", "[0:a][1:a]amix=inputs=2:duration=first:normalize=0",
+		out); err != nil {
+		return fmt.Errorf("ffmpeg click mix failed: %w", err)
+	}
+	return nil
+}
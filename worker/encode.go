@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/audioformat"
+)
+
+// encodeArgs are the ffmpeg output options for the format. kbps 0 means the
+// format's default (VBR quality for mp3); channels 0 keeps the input's.
+func encodeArgs(f audioformat.Format, kbps, sampleRate, channels int) []string {
+	if kbps == 0 {
+		kbps = f.DefaultKbps
+	}
+	bitrate := strconv.Itoa(kbps) + "k"
+	var args []string
+	switch f.Name {
+	case "mp3":
+		if kbps == 0 {
+			args = []string{"-codec:a", "libmp3lame", "-q:a", "2"}
+		} else {
+			args = []string{"-codec:a", "libmp3lame", "-b:a", bitrate}
+		}
+	case "m4a":
+		// faststart: players (and watches) can start before the whole file loads
+		args = []string{"-codec:a", "aac", "-b:a", bitrate, "-movflags", "+faststart"}
+	case "opus":
+		args = []string{"-codec:a", "libopus", "-b:a", bitrate}
+	case "flac":
+		args = []string{"-codec:a", "flac"}
+	default: // wav
+		args = []string{"-codec:a", "pcm_s16le"}
+	}
+	args = append(args, "-ar", strconv.Itoa(sampleRate))
+	if channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(channels))
+	}
+	return args
+}
+
+// outputLayout is the sample rate and channel count the format can carry
+// for a render at sampleRate with the source's channels: Opus only runs at
+// 48 kHz, MP3 holds at most stereo at up to 48 kHz.
+func outputLayout(f audioformat.Format, sampleRate, channels int) (int, int) {
+	switch f.Name {
+	case "opus":
+		sampleRate = 48000
+	case "mp3":
+		if channels > 2 {
+			channels = 2
+		}
+		switch {
+		case sampleRate > 48000 && sampleRate%44100 == 0:
+			sampleRate = 44100
+		case sampleRate > 48000:
+			sampleRate = 48000
+		}
+	}
+	return sampleRate, channels
+}
+
+// encodeAudio encodes a rendered WAV into the output format.
+func encodeAudio(ctx context.Context, in, out string, f audioformat.Format, kbps, sampleRate, channels int) error {
+	args := append([]string{"-y", "-i", in}, encodeArgs(f, kbps, sampleRate, channels)...)
+	if _, err := runFFmpeg(ctx, append(args, out)...); err != nil {
+		return fmt.Errorf("ffmpeg encode failed: %w", err)
+	}
+	return nil
+}
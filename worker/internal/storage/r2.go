@@ -90,3 +90,14 @@ func (c *R2Client) UploadFromFile(ctx context.Context, key, srcPath, contentType
 	}
 	return nil
 }
+
+func (c *R2Client) Delete(ctx context.Context, key string) error {
+	_, err := c.S3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("r2 delete object %q: %w", key, err)
+	}
+	return nil
+}
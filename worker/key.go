@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// A bin (sampleRate/chromaFrameSize, about 5.4 Hz at 44.1 kHz) has to be
+// narrower than a semitone for bins to land in the right pitch class; from
+// chromaMinHz (A2) up, a semitone is at least 6.5 Hz.
+const (
+	chromaFrameSize = 8192
+	chromaHopSize   = 8192 // frames don't need to overlap for a whole-track estimate
+	chromaMinHz     = 110.0
+	chromaMaxHz     = 2000.0
+)
+
+var pitchClassNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+// Krumhansl-Kessler key profiles, tonic first.
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+type keyResult struct {
+	Tonic      string // "C", "F#", "Bb", ...
+	Mode       string // "major" or "minor"
+	Camelot    string // "8B", "8A", ...
+	Confidence float64
+}
+
+// estimateKey correlates the track's average chroma vector against the 24
+// rotated key profiles and picks the best match.
+func estimateKey(samples []float32, sampleRate int) (keyResult, bool) {
+	chroma, ok := chromaVector(samples, sampleRate)
+	if !ok {
+		return keyResult{}, false
+	}
+
+	best, second := math.Inf(-1), math.Inf(-1)
+	var bestTonic int
+	var bestMode string
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []string{"major", "minor"} {
+			profile := majorProfile
+			if mode == "minor" {
+				profile = minorProfile
+			}
+			var rotated [12]float64
+			for i := 0; i < 12; i++ {
+				rotated[(i+tonic)%12] = profile[i]
+			}
+			r := pearson(chroma[:], rotated[:])
+			if r > best {
+				second = best
+				best, bestTonic, bestMode = r, tonic, mode
+			} else if r > second {
+				second = r
+			}
+		}
+	}
+
+	// A clear winner needs both a decent fit and some margin over the runner-up
+	// (usually the relative major/minor).
+	conf := clamp(best, 0, 1) * clamp((best-second)/0.05, 0, 1)
+
+	return keyResult{
+		Tonic:      pitchClassNames[bestTonic],
+		Mode:       bestMode,
+		Camelot:    camelot(bestTonic, bestMode),
+		Confidence: conf,
+	}, true
+}
+
+// chromaVector sums Hann-windowed spectral magnitude into the 12 pitch
+// classes (C=0) over the whole signal.
+func chromaVector(samples []float32, sampleRate int) ([12]float64, bool) {
+	var chroma [12]float64
+	if len(samples) < chromaFrameSize || sampleRate <= 0 {
+		return chroma, false
+	}
+
+	n := chromaFrameSize
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+	}
+
+	// Precompute bin -> pitch class
+	binPC := make([]int, n/2)
+	for k := range binPC {
+		f := float64(k) * float64(sampleRate) / float64(n)
+		if f < chromaMinHz || f > chromaMaxHz {
+			binPC[k] = -1
+			continue
+		}
+		midi := 69 + 12*math.Log2(f/440)
+		binPC[k] = ((int(math.Round(midi)) % 12) + 12) % 12
+	}
+
+	buf := make([]complex128, n)
+	frames := 0
+	for start := 0; start+n <= len(samples); start += chromaHopSize {
+		for i := 0; i < n; i++ {
+			buf[i] = complex(float64(samples[start+i])*window[i], 0)
+		}
+		fft(buf)
+		for k, pc := range binPC {
+			if pc >= 0 {
+				chroma[pc] += cmplx.Abs(buf[k])
+			}
+		}
+		frames++
+	}
+
+	var total float64
+	for _, v := range chroma {
+		total += v
+	}
+	if frames == 0 || total == 0 {
+		return chroma, false
+	}
+	return chroma, true
+}
+
+// camelot maps a key to its Camelot wheel position: neighbouring numbers
+// (and the same number across A/B) mix harmonically.
+func camelot(tonic int, mode string) string {
+	if mode == "minor" {
+		// Same number as the relative major
+		tonic = (tonic + 3) % 12
+	}
+	n := ((tonic*7)%12+7)%12 + 1
+	letter := "B"
+	if mode == "minor" {
+		letter = "A"
+	}
+	return fmt.Sprintf("%d%s", n, letter)
+}
+
+// fft is an in-place iterative radix-2 FFT; len(a) must be a power of two.
+func fft(a []complex128) {
+	n := len(a)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := a[start+k]
+				v := a[start+k+size/2] * w
+				a[start+k] = u + v
+				a[start+k+size/2] = u - v
+				w *= step
+			}
+		}
+	}
+}
+
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= n
+	my /= n
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const energyWindowSec = 10.0
+
+type loudnessResult struct {
+	IntegratedLUFS float64
+	RangeLU        float64
+	TruePeakDBTP   float64
+}
+
+var (
+	ebuIntegratedRe = regexp.MustCompile(`I:\s+(-?[\d.]+|-inf) LUFS`)
+	ebuRangeRe      = regexp.MustCompile(`LRA:\s+(-?[\d.]+) LU`)
+	ebuPeakRe       = regexp.MustCompile(`Peak:\s+(-?[\d.]+|-inf) dBFS`)
+)
+
+// measureLoudness runs ffmpeg's EBU R128 meter over the original file (not
+// the mono analysis WAV, so stereo content is measured as heard).
+func measureLoudness(ctx context.Context, inputPath string) (loudnessResult, error) {
+	out, err := runCmdOutput(ctx, "ffmpeg", "-hide_banner", "-nostats",
+		"-i", inputPath,
+		"-filter_complex", "ebur128=peak=true:framelog=verbose",
+		"-f", "null", "-",
+	)
+	if err != nil {
+		return loudnessResult{}, fmt.Errorf("ffmpeg ebur128 failed: %w", err)
+	}
+
+	// Only the summary block holds the whole-file values
+	i := strings.LastIndex(out, "Summary:")
+	if i < 0 {
+		return loudnessResult{}, errors.New("ebur128 summary not found in ffmpeg output")
+	}
+	summary := out[i:]
+
+	var res loudnessResult
+	if res.IntegratedLUFS, err = parseEbuValue(ebuIntegratedRe, summary); err != nil {
+		return loudnessResult{}, fmt.Errorf("integrated loudness: %w", err)
+	}
+	if res.RangeLU, err = parseEbuValue(ebuRangeRe, summary); err != nil {
+		return loudnessResult{}, fmt.Errorf("loudness range: %w", err)
+	}
+	if res.TruePeakDBTP, err = parseEbuValue(ebuPeakRe, summary); err != nil {
+		return loudnessResult{}, fmt.Errorf("true peak: %w", err)
+	}
+	return res, nil
+}
+
+func parseEbuValue(re *regexp.Regexp, s string) (float64, error) {
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.New("value not found")
+	}
+	if m[1] == "-inf" {
+		// digital silence; keep it finite so it fits a numeric column
+		return -120, nil
+	}
+	return strconv.ParseFloat(m[1], 64)
+}
+
+// energyCurve returns the RMS level (dBFS) of each energyWindowSec window.
+func energyCurve(samples []float32, sampleRate int) []float64 {
+	win := int(energyWindowSec * float64(sampleRate))
+	if win <= 0 {
+		return nil
+	}
+	var curve []float64
+	for start := 0; start < len(samples); start += win {
+		end := start + win
+		if end > len(samples) {
+			end = len(samples)
+		}
+		var sum float64
+		for _, x := range samples[start:end] {
+			sum += float64(x) * float64(x)
+		}
+		curve = append(curve, rmsDB(sum, end-start))
+	}
+	return curve
+}
+
+// energyScore condenses the curve into 0..1 for sorting: the average level
+// mapped from a quiet (-30 dBFS) to a very dense (-6 dBFS) master.
+func energyScore(curve []float64) float64 {
+	if len(curve) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, db := range curve {
+		sum += db
+	}
+	return clamp((sum/float64(len(curve))+30)/24, 0, 1)
+}
+
+func rmsDB(sumSquares float64, n int) float64 {
+	if n == 0 || sumSquares <= 0 {
+		return -120
+	}
+	return math.Max(-120, 10*math.Log10(sumSquares/float64(n)))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -14,12 +15,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/JGrinovich/bpm-runner-app/shared/audioformat"
+	"github.com/JGrinovich/bpm-runner-app/shared/rendercache"
+	"github.com/JGrinovich/bpm-runner-app/shared/stretch"
+	"github.com/JGrinovich/bpm-runner-app/shared/tempo"
 	"github.com/JGrinovich/bpm-runner-app/worker/internal/storage"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
+	// `worker bench ...` runs the accuracy benchmark instead of the job loop
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+
 	if os.Getenv("WORKER_DISABLED") == "1" {
 		log.Println("🛑 worker disabled via WORKER_DISABLED=1")
 		return
@@ -76,10 +86,15 @@ func main() {
 			log.Printf("🔎 claimed analysis job id=%s track=%s\n", analysisID, trackID)
 
 			jobCtx, cancel := context.WithTimeout(context.Background(), 6*time.Minute)
+			jobCtx, stop := watchCancel(jobCtx, pool, "track_analysis", analysisID)
 			err = runAnalysisJob(jobCtx, pool, r2c, analysisID, trackID)
+			canceled := jobCanceled(jobCtx, err)
+			stop()
 			cancel()
 
-			if err != nil {
+			if canceled {
+				log.Printf("🚫 analysis canceled id=%s track=%s\n", analysisID, trackID)
+			} else if err != nil {
 				log.Printf("❌ analysis failed id=%s track=%s err=%v\n", analysisID, trackID, err)
 				_ = markAnalysisFailed(context.Background(), pool, analysisID, err.Error())
 			} else {
@@ -103,10 +118,15 @@ func main() {
 				renderID, trackIDR, targetBpm, preservePitch)
 
 			jobCtx, cancel := context.WithTimeout(context.Background(), 12*time.Minute)
-			err := runRenderJob(jobCtx, pool, r2c, renderID, trackIDR, targetBpm)
+			jobCtx, stop := watchCancel(jobCtx, pool, "render_jobs", renderID)
+			err := runRenderJob(jobCtx, pool, r2c, renderID, trackIDR, targetBpm, preservePitch)
+			canceled := jobCanceled(jobCtx, err)
+			stop()
 			cancel()
 
-			if err != nil {
+			if canceled {
+				log.Printf("🚫 render canceled id=%s\n", renderID)
+			} else if err != nil {
 				log.Printf("❌ render failed id=%s err=%v\n", renderID, err)
 				_ = markRenderFailed(context.Background(), pool, renderID, err.Error())
 			} else {
@@ -138,11 +158,12 @@ WITH cte AS (
   FOR UPDATE SKIP LOCKED
 )
 UPDATE track_analysis ta
-SET status='running', error_message=NULL
+SET status='running', error_message=NULL,
+    algorithm=$1, algorithm_version=$2, params=$3
 FROM cte
 WHERE ta.id = cte.id
 RETURNING ta.id, ta.track_id;
-`).Scan(&analysisID, &trackID)
+`, analysisAlgorithm, analysisVersion, analysisParams()).Scan(&analysisID, &trackID)
 
 	if err != nil {
 		if strings.Contains(err.Error(), "no rows") {
@@ -178,66 +199,355 @@ func runAnalysisJob(ctx context.Context, pool *pgxpool.Pool, r2c *storage.R2Clie
 		return fmt.Errorf("failed to download from R2: %w", err)
 	}
 
+	meta, err := probeMetadata(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	sourceHash, err := fileSHA256(inputPath)
+	if err != nil {
+		return err
+	}
+
+	res, err := analyzeAudio(ctx, inputPath, tmpDir)
+	if err != nil {
+		return err
+	}
+
+	var timeSig *string
+	var beatsPerBar *int
+	var meterConf *float64
+	var barTimes []float32
+	if m := res.Meter; m != nil {
+		timeSig, beatsPerBar, meterConf = &m.TimeSignature, &m.BeatsPerBar, &m.Confidence
+		barTimes = toFloat32s(m.BarTimes)
+	}
+	var keyTonic, keyMode, keyCamelot *string
+	var keyConf *float64
+	if k := res.Key; k != nil {
+		keyTonic, keyMode, keyCamelot, keyConf = &k.Tonic, &k.Mode, &k.Camelot, &k.Confidence
+	}
+	silencesJSON, err := json.Marshal(res.Sections.Silences)
+	if err != nil {
+		return err
+	}
+	rawJSON, err := json.Marshal(res.Raw)
+	if err != nil {
+		return err
+	}
+	candidatesJSON, err := json.Marshal(res.Candidates)
+	if err != nil {
+		return err
+	}
+	runnableJSON, err := json.Marshal(res.Runnable)
+	if err != nil {
+		return err
+	}
+
+	// Removed again unless the run completes (it may fail or be canceled
+	// after the upload)
+	finished := false
+	waveformKey := analysisWaveformKey(analysisID)
+	defer func() {
+		if !finished {
+			deleteUploads(r2c, []string{waveformKey})
+		}
+	}()
+	if err := uploadWaveform(ctx, r2c, waveformKey, res.Waveform, tmpDir); err != nil {
+		return fmt.Errorf("upload waveform: %w", err)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Only a still-running job completes; a cancel may have landed meanwhile
+	tag, err := tx.Exec(ctx, `
+UPDATE track_analysis
+SET bpm=$1,
+    confidence=$2,
+    beat_times=$3,
+    time_signature=$4,
+    beats_per_bar=$5,
+    meter_confidence=$6,
+    bar_times=$7,
+    key_tonic=$8,
+    key_mode=$9,
+    key_camelot=$10,
+    key_confidence=$11,
+    loudness_lufs=$12,
+    loudness_range_lu=$13,
+    true_peak_dbtp=$14,
+    energy=$15,
+    energy_curve=$16,
+    duration_sec=$17,
+    intro_end_sec=$18,
+    outro_start_sec=$19,
+    silences=$20,
+    raw_candidates=$21,
+    tempo_candidates=$22,
+    runnability=$23,
+    runnability_detail=$24,
+    status='done',
+    error_message=NULL,
+    finished_at=now()
+WHERE id=$25 AND status='running';
+`, res.Bpm, res.Confidence, toFloat32s(res.BeatTimes), timeSig, beatsPerBar, meterConf, barTimes,
+		keyTonic, keyMode, keyCamelot, keyConf,
+		res.Loudness.IntegratedLUFS, res.Loudness.RangeLU, res.Loudness.TruePeakDBTP, res.Energy, toFloat32s(res.EnergyDB),
+		res.Sections.DurationSec, res.Sections.IntroEndSec, res.Sections.OutroStartSec, silencesJSON,
+		rawJSON, candidatesJSON, res.Runnable.Score, runnableJSON, analysisID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errJobCanceled
+	}
+
+	// A finished run becomes the one renders use, and its waveform replaces
+	// the previous run's
+	var oldWaveformKey *string
+	if err := tx.QueryRow(ctx, `SELECT waveform_object_key FROM tracks WHERE id=$1 FOR UPDATE`, trackID).Scan(&oldWaveformKey); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE tracks SET current_analysis_id=$1, waveform_object_key=$2 WHERE id=$3`, analysisID, waveformKey, trackID); err != nil {
+		return err
+	}
+
+	// Renders that were waiting for a tempo can go now
+	if _, err := tx.Exec(ctx, `UPDATE render_jobs SET status='queued' WHERE depends_on_analysis_id=$1 AND status='waiting'`, analysisID); err != nil {
+		return err
+	}
+
+	// File metadata; user-entered title/duration win over tags (an empty
+	// title or artist counts as none)
+	if _, err := tx.Exec(ctx, `
+UPDATE tracks
+SET codec=$1,
+    sample_rate=$2,
+    channels=$3,
+    bitrate_kbps=$4,
+    duration_sec=COALESCE(duration_sec, $5),
+    title=COALESCE(NULLIF(title, ''), $6),
+    artist=COALESCE(NULLIF(artist, ''), $7),
+    source_sha256=$8,
+    metadata_at=now()
+WHERE id=$9;
+`, nullIfEmpty(meta.Codec), nullIfEmpty(meta.SampleRate), nullIfEmpty(meta.Channels), nullIfEmpty(meta.BitrateKbps),
+		nullIfEmpty(meta.DurationSec), nullIfEmpty(meta.Title), nullIfEmpty(meta.Artist), sourceHash, trackID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	finished = true
+	if oldWaveformKey != nil && *oldWaveformKey != waveformKey {
+		// Best effort: the run is done either way
+		if err := r2c.Delete(ctx, *oldWaveformKey); err != nil {
+			log.Printf("delete old waveform: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// Every run records the algorithm and version that produced it, so results
+// can be compared across changes. Bump analysisVersion whenever a change can
+// alter the numbers, and add any new tuning knob to analysisParams.
+const (
+	analysisAlgorithm = "aubio-beat-median"
+	analysisVersion   = "1.2.2"
+)
+
+func analysisParams() map[string]any {
+	return map[string]any{
+		"window_start_sec": analysisWindowStart,
+		"window_len_sec":   analysisWindowLen,
+		"bpm_min":          analysisMinBpm,
+		"bpm_max":          analysisMaxBpm,
+		"silence_noise_db": silenceNoiseDB,
+		"silence_min_sec":  silenceMinSec,
+		"accent_lowpass":   accentLowpassHz,
+		"chroma_frame":     chromaFrameSize,
+		"chroma_min_hz":    chromaMinHz,
+		"run_cadence_min":  runCadenceMin,
+		"run_cadence_max":  runCadenceMax,
+	}
+}
+
+// Tempo is estimated from a window in the middle of the track (intros and
+// outros are often beatless); the beat grid itself covers the whole track.
+const (
+	analysisWindowStart = 45.0
+	analysisWindowLen   = 90.0
+	analysisMinBpm      = 60.0
+	analysisMaxBpm      = 220.0
+)
+
+// rawTempo keeps the intermediate estimates behind the final BPM.
+type rawTempo struct {
+	BeatBpm         float64   `json:"beat_bpm"`
+	BeatConfidence  float64   `json:"beat_confidence"`
+	AubioTempoBpm   float64   `json:"aubio_tempo_bpm"`
+	OctaveVariants  []float64 `json:"octave_variants"`
+	ChosenBpm       float64   `json:"chosen_bpm"`
+	ChosenClamped   bool      `json:"chosen_clamped"`
+	WindowBeatCount int       `json:"window_beat_count"`
+}
+
+type analysisResult struct {
+	Bpm        float64
+	Confidence float64
+	BeatTimes  []float64 // seconds from the start of the original file
+	Meter      *meterResult
+	Key        *keyResult
+	Loudness   *loudnessResult
+	Energy     float64
+	EnergyDB   []float64 // RMS level per energyWindowSec window
+	Sections   sectionsResult
+	Raw        rawTempo
+	Candidates []tempoCandidate
+	Runnable   runnabilityResult
+	Waveform   waveform
+}
+
+func analyzeAudio(ctx context.Context, inputPath, tmpDir string) (*analysisResult, error) {
+	fullWav := filepath.Join(tmpDir, "full.wav")
+	if err := runCmd(ctx, "ffmpeg", "-y",
+		"-i", inputPath,
+		"-ac", "1", "-ar", "44100",
+		fullWav,
+	); err != nil {
+		return nil, fmt.Errorf("ffmpeg convert failed: %w", err)
+	}
+
 	workingWav := filepath.Join(tmpDir, "working.wav")
 	// 1) Convert to consistent WAV
 	if err := runCmd(ctx, "ffmpeg", "-y",
-		"-ss", "45", "-t", "90",
+		"-ss", strconv.FormatFloat(analysisWindowStart, 'f', -1, 64),
+		"-t", strconv.FormatFloat(analysisWindowLen, 'f', -1, 64),
 		"-i", inputPath, // Use downloaded file
 		"-ac", "1", "-ar", "44100",
 		workingWav,
 	); err != nil {
-		return fmt.Errorf("ffmpeg convert failed: %w", err)
+		return nil, fmt.Errorf("ffmpeg convert failed: %w", err)
 	}
 
 	tempoBpm, err := aubioTempoBPM(ctx, workingWav)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	beats, err := aubioBeatTimes(ctx, workingWav)
+	beats, err := aubioBeatTimes(ctx, fullWav)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	beatBpm, beatConf, ok := bpmAndConfidenceFromBeats(beats)
+	windowBeats := beatsInRange(beats, analysisWindowStart, analysisWindowStart+analysisWindowLen)
+	if len(windowBeats) < 8 {
+		// Short track: the window doesn't hold enough beats, use all of them
+		windowBeats = beats
+	}
+
+	beatBpm, beatConf, ok := tempo.BPMAndConfidenceFromBeats(windowBeats)
 	if !ok {
-		return errors.New("not enough beat events detected to estimate BPM")
+		return nil, errors.New("not enough beat events detected to estimate BPM")
 	}
 
 	chosen, conf := chooseBestTempo(beatBpm, beatConf, tempoBpm)
 
 	// Clamp final BPM
-	finalBpm := clamp(chosen, 60, 220)
+	finalBpm := clamp(chosen, analysisMinBpm, analysisMaxBpm)
+	clamped := finalBpm != chosen
 	if math.Abs(finalBpm-chosen) > 0.1 {
 		conf *= 0.7
 		conf = clamp(conf, 0, 1)
 	}
+	// Same precision as the candidates, so the selected one matches exactly
+	finalBpm = math.Round(finalBpm*100) / 100
+	candidates := rankTempoCandidates(beatBpm, tempoBpm, chosen, finalBpm)
+
+	res := &analysisResult{
+		Bpm:        finalBpm,
+		Confidence: conf,
+		BeatTimes:  beats,
+		Candidates: candidates,
+		Raw: rawTempo{
+			BeatBpm:         beatBpm,
+			BeatConfidence:  beatConf,
+			AubioTempoBpm:   tempoBpm,
+			OctaveVariants:  resolveTempo(beatBpm),
+			ChosenBpm:       chosen,
+			ChosenClamped:   clamped,
+			WindowBeatCount: len(windowBeats),
+		},
+	}
 
-	_, err = pool.Exec(ctx, `
-UPDATE track_analysis
-SET bpm=$1,
-    confidence=$2,
-    status='done',
-    error_message=NULL,
-    finished_at=now()
-WHERE id=$3;
-`, finalBpm, conf, analysisID)
+	samples, sampleRate, err := readWavMono(fullWav)
+	if err != nil {
+		return nil, fmt.Errorf("read wav failed: %w", err)
+	}
 
-	return err
+	if m, ok := estimateMeter(beats, beatAccents(samples, sampleRate, beats), beatBpm); ok {
+		res.Meter = &m
+	}
+
+	if k, ok := estimateKey(samples, sampleRate); ok {
+		res.Key = &k
+	}
+
+	loud, err := measureLoudness(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	res.Loudness = &loud
+	res.EnergyDB = energyCurve(samples, sampleRate)
+	res.Energy = energyScore(res.EnergyDB)
+
+	duration := float64(len(samples)) / float64(sampleRate)
+	silences, err := detectSilences(ctx, inputPath, duration)
+	if err != nil {
+		return nil, err
+	}
+	res.Sections = detectSections(samples, sampleRate, beats, silences)
+
+	res.Runnable = scoreRunnability(samples, sampleRate, beats, finalBpm, beatConf, res.Energy, res.Meter)
+	res.Waveform = buildWaveform(samples, sampleRate)
+
+	return res, nil
 }
 
 func markAnalysisFailed(ctx context.Context, pool *pgxpool.Pool, analysisID, msg string) error {
 	if len(msg) > 500 {
 		msg = msg[:500]
 	}
-	_, err := pool.Exec(ctx, `
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `
 UPDATE track_analysis
 SET status='failed',
     error_message=$1,
     finished_at=now()
-WHERE id=$2;
-`, msg, analysisID)
-	return err
+WHERE id=$2 AND status<>'canceled';
+`, msg, analysisID); err != nil {
+		return err
+	}
+
+	// Renders waiting on this run can't get a tempo from it
+	if _, err := tx.Exec(ctx, `
+UPDATE render_jobs
+SET status='failed',
+    error_message=$1,
+    finished_at=now()
+WHERE depends_on_analysis_id=$2 AND status='waiting';
+`, "analysis failed: "+msg, analysisID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func claimNextRenderJob(ctx context.Context, pool *pgxpool.Pool) (bool, string, string, float64, bool, error) {
@@ -261,7 +571,8 @@ WITH cte AS (
   FOR UPDATE SKIP LOCKED
 )
 UPDATE render_jobs r
-SET status='running', error_message=NULL
+SET status='running', error_message=NULL,
+    progress=0, progress_stage=NULL, eta_sec=NULL, progress_at=now()
 FROM cte
 WHERE r.id = cte.id
 RETURNING r.id, r.track_id, r.target_bpm, r.preserve_pitch;
@@ -290,7 +601,7 @@ UPDATE render_jobs
 SET status='failed',
     error_message=$1,
     finished_at=now()
-WHERE id=$2;
+WHERE id=$2 AND status<>'canceled';
 `, msg, renderID)
 	return err
 }
@@ -320,27 +631,172 @@ func buildAtempoChain(ratio float64) (string, error) {
 	return strings.Join(parts, ","), nil
 }
 
-func runRenderJob(ctx context.Context, pool *pgxpool.Pool, r2c *storage.R2Client, renderID, trackID string, targetBpm float64) error {
+// buildTrimFilter cuts the source to [start, end); either bound may be nil.
+func buildTrimFilter(start, end *float64) string {
+	var opts []string
+	if start != nil && *start > 0 {
+		opts = append(opts, fmt.Sprintf("start=%.3f", *start))
+	}
+	if end != nil {
+		opts = append(opts, fmt.Sprintf("end=%.3f", *end))
+	}
+	if len(opts) == 0 {
+		return "anull"
+	}
+	return "atrim=" + strings.Join(opts, ":") + ",asetpts=PTS-STARTPTS"
+}
+
+// Sample rate for renders when neither the request nor the source says
+const defaultRenderSampleRate = 44100
+
+func runRenderJob(ctx context.Context, pool *pgxpool.Pool, r2c *storage.R2Client, renderID, trackID string, targetBpm float64, preservePitch bool) error {
 	// Input key from tracks (R2 key)
 	var srcKey string
 	if err := pool.QueryRow(ctx, `SELECT original_object_key FROM tracks WHERE id=$1`, trackID).Scan(&srcKey); err != nil {
 		return fmt.Errorf("track not found: %w", err)
 	}
 
-	// Analysis must be done
+	var trimMode string
+	var trimStart, trimEnd *float64
+	var candidateIdx *int
+	var candidateBpm *float64
+	var engineName, enginePreset *string
+	var formatName string
+	var bitrateKbps, requestedRate *int
+	var normLUFS, normTP *float64
+	var clickJSON, rampJSON, intervalsJSON []byte
+	var mode string
+	if err := pool.QueryRow(ctx, `
+SELECT trim_mode, trim_start_sec, trim_end_sec, tempo_candidate, tempo_candidate_bpm, engine, engine_quality, output_format, bitrate_kbps, sample_rate,
+       normalize_lufs, normalize_true_peak, click, render_mode, ramp, intervals
+FROM render_jobs WHERE id=$1`, renderID).Scan(&trimMode, &trimStart, &trimEnd, &candidateIdx, &candidateBpm, &engineName, &enginePreset,
+		&formatName, &bitrateKbps, &requestedRate, &normLUFS, &normTP, &clickJSON, &mode, &rampJSON, &intervalsJSON); err != nil {
+		return fmt.Errorf("render job not found: %w", err)
+	}
+	var ramp rampOptions
+	var intervals intervalOptions
+	switch mode {
+	case "ramp":
+		if err := json.Unmarshal(rampJSON, &ramp); err != nil {
+			return fmt.Errorf("bad ramp options: %w", err)
+		}
+	case "intervals":
+		if err := json.Unmarshal(intervalsJSON, &intervals); err != nil {
+			return fmt.Errorf("bad interval options: %w", err)
+		}
+	}
+	var click *clickOptions
+	if len(clickJSON) > 0 {
+		click = &clickOptions{}
+		if err := json.Unmarshal(clickJSON, click); err != nil {
+			return fmt.Errorf("bad click options: %w", err)
+		}
+	}
+	format, ok := audioformat.Lookup(formatName)
+	if !ok {
+		return fmt.Errorf("unknown output format %q", formatName)
+	}
+	kbps := 0
+	if bitrateKbps != nil {
+		kbps = *bitrateKbps
+	}
+
+	// Source tempo, in order of precedence: a tempo candidate the user picked,
+	// the user's override, the track's current analysis
+	var analysisBpm, overrideBpm, overrideOffset *float64
+	var aStatus *string
+	var introEnd, outroStart *float64
+	var candidatesJSON []byte
+	var beatTimes []float32
+	var analysisID *string
+	if err := pool.QueryRow(ctx, `
+SELECT t.bpm_override, t.bpm_override_offset_sec, t.current_analysis_id, a.bpm, a.status, a.intro_end_sec, a.outro_start_sec, a.tempo_candidates, a.beat_times
+FROM tracks t
+LEFT JOIN track_analysis a ON a.id = t.current_analysis_id
+WHERE t.id=$1`, trackID).Scan(&overrideBpm, &overrideOffset, &analysisID, &analysisBpm, &aStatus, &introEnd, &outroStart, &candidatesJSON, &beatTimes); err != nil {
+		return fmt.Errorf("track not found: %w", err)
+	}
+
 	var detectedBpm float64
-	var aStatus string
-	if err := pool.QueryRow(ctx, `SELECT bpm, status FROM track_analysis WHERE track_id=$1`, trackID).Scan(&detectedBpm, &aStatus); err != nil {
-		return fmt.Errorf("missing analysis: %w", err)
+	var bpmOrigin string
+	switch {
+	case candidateBpm != nil && *candidateBpm > 0:
+		detectedBpm, bpmOrigin = *candidateBpm, "candidate"
+	case candidateIdx != nil:
+		// Renders queued before the API resolved candidates to a BPM
+		var cands []tempoCandidate
+		if len(candidatesJSON) > 0 {
+			if err := json.Unmarshal(candidatesJSON, &cands); err != nil {
+				return fmt.Errorf("bad tempo candidates: %w", err)
+			}
+		}
+		if *candidateIdx < 0 || *candidateIdx >= len(cands) {
+			return fmt.Errorf("tempo candidate %d not in current analysis (%d candidates)", *candidateIdx, len(cands))
+		}
+		detectedBpm, bpmOrigin = cands[*candidateIdx].Bpm, "candidate"
+	case overrideBpm != nil && *overrideBpm > 0:
+		detectedBpm, bpmOrigin = *overrideBpm, "override"
+	case aStatus != nil && *aStatus == "done" && analysisBpm != nil && *analysisBpm > 0:
+		detectedBpm, bpmOrigin = *analysisBpm, "analysis"
+	default:
+		return errors.New("analysis not ready and no BPM override set")
+	}
+
+	// The cache key is the request as the API saw it (before auto trim
+	// resolves), except for the engine: see below
+	cacheParams := rendercache.Params{
+		SourceBpm: detectedBpm,
+		TargetBpm: targetBpm,
+		Mode:      mode,
+		Ramp:      rampJSON,
+		Intervals: intervalsJSON,
+		Format:    format.Name,
+		TrimMode:  trimMode,
+		TrimStart: trimStart,
+		TrimEnd:   trimEnd,
+
+		NormalizeLUFS:     normLUFS,
+		NormalizeTruePeak: normTP,
+		Click:             clickJSON,
+	}
+	if analysisID != nil {
+		cacheParams.AnalysisID = *analysisID
+	}
+	if bpmOrigin == "override" {
+		cacheParams.BeatOffset = overrideOffset
+	}
+	if bitrateKbps != nil {
+		cacheParams.BitrateKbps = *bitrateKbps
 	}
-	if aStatus != "done" || detectedBpm <= 0 {
-		return fmt.Errorf("analysis not ready (status=%s bpm=%v)", aStatus, detectedBpm)
+	if requestedRate != nil {
+		cacheParams.SampleRate = *requestedRate
 	}
 
-	ratio := targetBpm / detectedBpm
-	chain, err := buildAtempoChain(ratio)
-	if err != nil {
-		return err
+	if trimMode == "auto" {
+		if introEnd == nil || outroStart == nil {
+			return errors.New("auto trim needs intro/outro detection (re-run analysis)")
+		}
+		trimStart, trimEnd = introEnd, outroStart
+	}
+
+	// Renders from before engines were selectable only say whether to keep pitch
+	name := stretch.Default(preservePitch)
+	if engineName != nil {
+		name = *engineName
+	}
+	preset := ""
+	if enginePreset != nil {
+		preset = *enginePreset
+	}
+	engine, preset := pickStretchEngine(ctx, name, preset)
+	// Keyed on what actually runs, so an atempo fallback is only ever reused
+	// for atempo requests
+	cacheParams.Engine, cacheParams.Quality = engine.Name(), preset
+
+	// Trim happens on the source timeline, before stretching
+	pre := ""
+	if trimMode != "none" {
+		pre = buildTrimFilter(trimStart, trimEnd)
 	}
 
 	tmpDir, err := os.MkdirTemp("", "render-*")
@@ -354,32 +810,203 @@ func runRenderJob(ctx context.Context, pool *pgxpool.Pool, r2c *storage.R2Client
 		return err
 	}
 
+	// Unlike analysis, renders keep the source's channel layout and (unless
+	// the request names one) its sample rate
+	meta, err := probeMetadata(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	cacheParams.SourceSHA256, err = fileSHA256(inputPath)
+	if err != nil {
+		return err
+	}
+	// Tracks analysed before hashing existed get theirs here
+	if _, err := pool.Exec(ctx, `UPDATE tracks SET source_sha256=$1 WHERE id=$2 AND source_sha256 IS NULL`,
+		cacheParams.SourceSHA256, trackID); err != nil {
+		return err
+	}
+	stages := []string{"prepare", "stretch"}
+	if click != nil {
+		stages = append(stages, "click")
+	}
+	if normLUFS != nil && normTP != nil {
+		stages = append(stages, "normalize")
+	}
+	prog := newRenderProgress(pool, renderID, append(stages, "encode")...)
+	ctx = withProgress(ctx, prog)
+	prog.begin(ctx, "prepare", meta.Duration)
+
+	sampleRate := meta.SampleRate
+	if requestedRate != nil {
+		sampleRate = *requestedRate
+	}
+	if sampleRate <= 0 {
+		sampleRate = defaultRenderSampleRate
+	}
+
 	workingWav := filepath.Join(tmpDir, "working.wav")
-	if err := runCmd(ctx, "ffmpeg", "-y", "-i", inputPath, "-ac", "1", "-ar", "44100", workingWav); err != nil {
+	if _, err := runFFmpeg(ctx, "-y", "-i", inputPath, "-ar", strconv.Itoa(sampleRate), workingWav); err != nil {
 		return fmt.Errorf("ffmpeg wav convert failed: %w", err)
 	}
 
-	outLocal := filepath.Join(tmpDir, "out.mp3")
-	if err := runCmd(ctx, "ffmpeg", "-y", "-i", workingWav, "-filter:a", chain, "-codec:a", "libmp3lame", "-q:a", "2", outLocal); err != nil {
-		return fmt.Errorf("ffmpeg render failed: %w", err)
+	// Container durations can be estimates (VBR mp3); the WAV's is exact
+	working, err := probeMetadata(ctx, workingWav)
+	if err != nil {
+		return err
+	}
+
+	// The segment plan maps the (trimmed) source onto the render's timeline
+	srcStart, srcEnd := 0.0, working.Duration
+	if trimStart != nil {
+		srcStart = *trimStart
+	}
+	if trimEnd != nil && *trimEnd < srcEnd {
+		srcEnd = *trimEnd
+	}
+	if srcEnd <= srcStart {
+		return fmt.Errorf("nothing to render: source range %.2f-%.2fs", srcStart, srcEnd)
+	}
+	grid := sourceBeatGrid(toFloat64s(beatTimes), detectedBpm, bpmOrigin, overrideOffset, srcEnd)
+	var plan []renderSegment
+	switch mode {
+	case "ramp":
+		plan = rampPlan(ramp, grid, srcStart, srcEnd, detectedBpm)
+	case "intervals":
+		plan = intervalPlan(intervals, grid, srcStart, srcEnd, detectedBpm)
+	default:
+		plan = constantPlan(srcStart, srcEnd, detectedBpm, targetBpm)
+	}
+	// Reported ratio: where the render ends up
+	ratio := plan[len(plan)-1].Ratio
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+
+	// Every later stage works on audio of the render's length
+	outDur := plan[len(plan)-1].OutEnd
+	stretchedWav := filepath.Join(tmpDir, "stretched.wav")
+	if len(plan) == 1 {
+		prog.begin(ctx, "stretch", outDur)
+		err = engine.Stretch(ctx, workingWav, stretchedWav, pre, ratio, sampleRate, preset)
+	} else {
+		// The segments, then joining them
+		prog.begin(ctx, "stretch", float64(1+joinPasses(len(plan)))*outDur)
+		err = renderSegments(ctx, engine, workingWav, stretchedWav, plan, sampleRate, preset, tmpDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	finalWav := stretchedWav
+	if click != nil {
+		prog.begin(ctx, "click", outDur)
+		clickWav := filepath.Join(tmpDir, "click.wav")
+		if err := writeClickTrack(clickWav, clickTimes(grid, plan, click.Every), *click, sampleRate, meta.Channels); err != nil {
+			return err
+		}
+		mixedWav := filepath.Join(tmpDir, "mixed.wav")
+		if err := mixClick(ctx, finalWav, clickWav, mixedWav); err != nil {
+			return err
+		}
+		finalWav = mixedWav
+	}
+
+	// Normalize last, so the measurement covers exactly what's encoded
+	var norm *normalizeResult
+	if normLUFS != nil && normTP != nil {
+		prog.begin(ctx, "normalize", 2*outDur) // measure, then apply
+		normalizedWav := filepath.Join(tmpDir, "normalized.wav")
+		res, err := normalizeLoudness(ctx, finalWav, normalizedWav, *normLUFS, *normTP, sampleRate)
+		if err != nil {
+			return err
+		}
+		if res.Type != "skipped" {
+			finalWav = normalizedWav
+		}
+		norm = &res
+	}
+
+	prog.begin(ctx, "encode", outDur)
+	outLocal := filepath.Join(tmpDir, "out"+format.Ext)
+	outRate, outChannels := outputLayout(format, sampleRate, meta.Channels)
+	if err := encodeAudio(ctx, finalWav, outLocal, format, kbps, outRate, outChannels); err != nil {
+		return err
 	}
 
-	outKey := fmt.Sprintf("renders/%s.mp3", uuid.New().String())
-	if err := r2c.UploadFromFile(ctx, outKey, outLocal, "audio/mpeg"); err != nil {
+	// Uploads are removed again unless the render gets marked done (it may
+	// fail or be canceled after them)
+	var uploaded []string
+	finished := false
+	defer func() {
+		if !finished {
+			deleteUploads(r2c, uploaded)
+		}
+	}()
+
+	outKey := fmt.Sprintf("renders/%s%s", uuid.New().String(), format.Ext)
+	uploaded = append(uploaded, outKey)
+	if err := r2c.UploadFromFile(ctx, outKey, outLocal, format.ContentType); err != nil {
 		return err
 	}
 
-	_, err = pool.Exec(ctx, `
+	wf, err := fileWaveform(ctx, outLocal, tmpDir)
+	if err != nil {
+		return err
+	}
+	waveformKey := renderWaveformKey(renderID)
+	uploaded = append(uploaded, waveformKey)
+	if err := uploadWaveform(ctx, r2c, waveformKey, wf, tmpDir); err != nil {
+		return fmt.Errorf("upload waveform: %w", err)
+	}
+
+	var inLUFS, inTP, inLRA, outLUFS, outTP *float64
+	var normType *string
+	if n := norm; n != nil {
+		inLUFS, inTP, inLRA = &n.InputLUFS, &n.InputTruePeak, &n.InputLRA
+		outLUFS, outTP, normType = &n.OutputLUFS, &n.OutputTruePeak, &n.Type
+	}
+	// Only a still-running job completes; a cancel may have landed meanwhile
+	tag, err := pool.Exec(ctx, `
 UPDATE render_jobs
 SET tempo_ratio=$1,
     output_object_key=$2,
+    trim_start_sec=$3,
+    trim_end_sec=$4,
+    source_bpm=$5,
+    source_bpm_origin=$6,
+    waveform_object_key=$7,
+    stretch_method=$8,
+    stretch_quality=$9,
+    output_sample_rate=$10,
+    output_channels=$11,
+    measured_lufs=$12,
+    measured_true_peak=$13,
+    measured_lra=$14,
+    normalized_lufs=$15,
+    normalized_true_peak=$16,
+    normalization_type=$17,
+    segment_plan=$18,
+    cache_key=$19,
+    progress=1,
+    eta_sec=0,
+    progress_at=now(),
     status='done',
     error_message=NULL,
     finished_at=now()
-WHERE id=$3;
-`, ratio, outKey, renderID)
-
-	return err
+WHERE id=$20 AND status='running';
+`, ratio, outKey, trimStart, trimEnd, detectedBpm, bpmOrigin, waveformKey, engine.Name(), preset,
+		outRate, nullIfEmpty(outChannels),
+		inLUFS, inTP, inLRA, outLUFS, outTP, normType,
+		planJSON, nullIfEmpty(rendercache.Key(cacheParams)), renderID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errJobCanceled
+	}
+	finished = true
+	return nil
 }
 
 func runCmd(ctx context.Context, name string, args ...string) error {
@@ -391,6 +1018,15 @@ func runCmd(ctx context.Context, name string, args ...string) error {
 	return nil
 }
 
+func runCmdOutput(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %v: %w\n%s", name, args, err, string(out))
+	}
+	return string(out), nil
+}
+
 func aubioBeatTimes(ctx context.Context, wavPath string) ([]float64, error) {
 	cmd := exec.CommandContext(ctx, "aubio", "beat", "-i", wavPath)
 	out, err := cmd.CombinedOutput()
@@ -417,40 +1053,11 @@ func aubioBeatTimes(ctx context.Context, wavPath string) ([]float64, error) {
 	return beats, nil
 }
 
-func bpmAndConfidenceFromBeats(beats []float64) (bpm float64, confidence float64, ok bool) {
-	if len(beats) < 8 {
-		return 0, 0, false
-	}
-
-	var intervals []float64
-	for i := 1; i < len(beats); i++ {
-		d := beats[i] - beats[i-1]
-		if d > 0.2 && d < 2.0 {
-			intervals = append(intervals, d)
-		}
-	}
-	if len(intervals) < 6 {
-		return 0, 0, false
-	}
-
-	sort.Float64s(intervals)
-	med := median(intervals)
-	if med <= 0 {
-		return 0, 0, false
-	}
-	bpm = 60.0 / med
-
-	var absDev []float64
-	for _, d := range intervals {
-		absDev = append(absDev, math.Abs(d-med))
-	}
-	sort.Float64s(absDev)
-	mad := median(absDev)
-
-	confidence = 1.0 - (mad / med)
-	confidence = clamp(confidence, 0, 1)
-
-	return bpm, confidence, true
+// beatsInRange returns the beats in [from, to). beats must be sorted.
+func beatsInRange(beats []float64, from, to float64) []float64 {
+	lo := sort.SearchFloat64s(beats, from)
+	hi := sort.SearchFloat64s(beats, to)
+	return beats[lo:hi]
 }
 
 func aubioTempoBPM(ctx context.Context, wavPath string) (float64, error) {
@@ -480,6 +1087,16 @@ func resolveTempo(raw float64) []float64 {
 	return []float64{raw, raw * 2.0, raw * 0.5}
 }
 
+// tempoDistance is how far candidate c is from a reference estimate, with a
+// flat penalty for tempos outside the range we clamp to.
+func tempoDistance(c, ref float64) float64 {
+	d := math.Abs(c - ref)
+	if c < analysisMinBpm || c > analysisMaxBpm {
+		d += 50
+	}
+	return d
+}
+
 func chooseBestTempo(beatBpm float64, beatConf float64, tempoBpm float64) (chosenBpm float64, chosenConf float64) {
 	cands := resolveTempo(beatBpm)
 
@@ -487,10 +1104,7 @@ func chooseBestTempo(beatBpm float64, beatConf float64, tempoBpm float64) (chose
 	bestScore := math.Inf(1)
 
 	for _, c := range cands {
-		score := math.Abs(c - tempoBpm)
-		if c < 60 || c > 220 {
-			score += 50
-		}
+		score := tempoDistance(c, tempoBpm)
 		if score < bestScore {
 			bestScore = score
 			best = c
@@ -505,6 +1119,22 @@ func chooseBestTempo(beatBpm float64, beatConf float64, tempoBpm float64) (chose
 	return best, clamp(conf, 0, 1)
 }
 
+func toFloat32s(a []float64) []float32 {
+	out := make([]float32, len(a))
+	for i, v := range a {
+		out[i] = float32(v)
+	}
+	return out
+}
+
+func toFloat64s(a []float32) []float64 {
+	out := make([]float64, len(a))
+	for i, v := range a {
+		out[i] = float64(v)
+	}
+	return out
+}
+
 func median(a []float64) float64 {
 	n := len(a)
 	if n == 0 {
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sourceMetadata is what ffprobe tells us about the uploaded file.
+type sourceMetadata struct {
+	Codec       string
+	SampleRate  int
+	Channels    int
+	BitrateKbps int
+	DurationSec int
+	Duration    float64 // seconds, unrounded
+	Title       string
+	Artist      string
+}
+
+func probeMetadata(ctx context.Context, inputPath string) (sourceMetadata, error) {
+	out, err := runCmdOutput(ctx, "ffprobe", "-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,sample_rate,channels,bit_rate:format=duration,bit_rate:format_tags=title,artist",
+		"-of", "json", inputPath)
+	if err != nil {
+		return sourceMetadata{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			CodecName  string `json:"codec_name"`
+			SampleRate string `json:"sample_rate"`
+			Channels   int    `json:"channels"`
+			BitRate    string `json:"bit_rate"`
+		} `json:"streams"`
+		Format struct {
+			Duration string            `json:"duration"`
+			BitRate  string            `json:"bit_rate"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal([]byte(out), &probe); err != nil {
+		return sourceMetadata{}, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return sourceMetadata{}, fmt.Errorf("no audio stream in source")
+	}
+
+	st := probe.Streams[0]
+	m := sourceMetadata{Codec: st.CodecName, Channels: st.Channels}
+	m.SampleRate, _ = strconv.Atoi(st.SampleRate)
+	bitrate := st.BitRate
+	if bitrate == "" || bitrate == "N/A" {
+		bitrate = probe.Format.BitRate
+	}
+	if v, err := strconv.Atoi(bitrate); err == nil {
+		m.BitrateKbps = int(math.Round(float64(v) / 1000))
+	}
+	if v, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		m.Duration = v
+		m.DurationSec = int(math.Round(v))
+	}
+	// Tag keys vary in case between containers
+	for k, v := range probe.Format.Tags {
+		switch strings.ToLower(k) {
+		case "title":
+			m.Title = strings.TrimSpace(v)
+		case "artist":
+			m.Artist = strings.TrimSpace(v)
+		}
+	}
+	return m, nil
+}
+
+// nullIfEmpty maps zero values to SQL NULL.
+func nullIfEmpty[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+// fileSHA256 hashes the uploaded file, so identical uploads can share
+// renders.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
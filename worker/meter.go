@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	accentWindowSec = 0.07  // energy window after each beat
+	accentLowpassHz = 150.0 // kick/bass band, where downbeats usually show up
+)
+
+type meterResult struct {
+	TimeSignature string // "4/4", "3/4" or "6/8"
+	BeatsPerBar   int
+	Confidence    float64
+	BarTimes      []float64 // downbeat times, seconds
+}
+
+// beatAccents measures how strongly each beat is accented: mostly the
+// low-band energy right after the beat, plus the broadband energy jump.
+func beatAccents(samples []float32, sampleRate int, beats []float64) []float64 {
+	w := int(accentWindowSec * float64(sampleRate))
+	alpha := 1 - math.Exp(-2*math.Pi*accentLowpassHz/float64(sampleRate))
+
+	acc := make([]float64, len(beats))
+	for i, b := range beats {
+		idx := int(b * float64(sampleRate))
+		start := idx - 3*w
+		if start < 0 {
+			start = 0
+		}
+		end := idx + w
+		if end > len(samples) {
+			end = len(samples)
+		}
+		if idx >= end {
+			continue
+		}
+
+		var low float64
+		var lowAfter, broadAfter, broadBefore float64
+		var nAfter, nBefore int
+		for j := start; j < end; j++ {
+			x := float64(samples[j])
+			low += alpha * (x - low)
+			if j >= idx {
+				lowAfter += low * low
+				broadAfter += x * x
+				nAfter++
+			} else if j >= idx-w {
+				broadBefore += x * x
+				nBefore++
+			}
+		}
+		if nAfter == 0 {
+			continue
+		}
+		lowAfter /= float64(nAfter)
+		broadAfter /= float64(nAfter)
+		if nBefore > 0 {
+			broadBefore /= float64(nBefore)
+		}
+
+		const eps = 1e-10
+		onset := math.Max(0, math.Log(broadAfter+eps)-math.Log(broadBefore+eps))
+		acc[i] = 0.7*math.Log(lowAfter+eps) + 0.3*onset
+	}
+	return zscore(acc)
+}
+
+// estimateMeter looks for a periodic accent pattern on top of the beat
+// grid. Duple meter wins ties: a song has to show a clearly stronger
+// three-beat pattern to be called 3/4 (or 6/8 when the beat is fast enough
+// that it's really eighth notes grouped in threes).
+func estimateMeter(beats, accents []float64, beatBpm float64) (meterResult, bool) {
+	if len(beats) < 16 || len(accents) != len(beats) {
+		return meterResult{}, false
+	}
+
+	phase4, score4 := bestAccentPhase(accents, 4)
+	phase3, score3 := bestAccentPhase(accents, 3)
+
+	m := meterResult{TimeSignature: "4/4", BeatsPerBar: 4}
+	phase := phase4
+	winner, loser := score4, score3
+	if score3 > score4*1.15 && score3 > 0 {
+		m = meterResult{TimeSignature: "3/4", BeatsPerBar: 3}
+		phase = phase3
+		winner, loser = score3, score4
+		if beatBpm >= 150 {
+			// Beat tracker is following eighth notes: two groups of three per bar.
+			m = meterResult{TimeSignature: "6/8", BeatsPerBar: 6}
+			phase6, _ := bestAccentPhase(accents, 6)
+			if phase6%3 == phase3 {
+				phase = phase6
+			}
+		}
+	}
+	if winner <= 0 {
+		return meterResult{}, false
+	}
+
+	m.Confidence = clamp((winner-math.Max(loser, 0))/winner, 0, 1)
+	for i := phase; i < len(beats); i += m.BeatsPerBar {
+		m.BarTimes = append(m.BarTimes, beats[i])
+	}
+	return m, true
+}
+
+// bestAccentPhase returns the phase (0..period-1) whose beats are most
+// accented relative to the rest, and by how much.
+func bestAccentPhase(accents []float64, period int) (int, float64) {
+	bestPhase, bestScore := 0, math.Inf(-1)
+	for p := 0; p < period; p++ {
+		var on, off float64
+		var nOn, nOff int
+		for i, a := range accents {
+			if i%period == p {
+				on += a
+				nOn++
+			} else {
+				off += a
+				nOff++
+			}
+		}
+		if nOn == 0 || nOff == 0 {
+			continue
+		}
+		score := on/float64(nOn) - off/float64(nOff)
+		if score > bestScore {
+			bestScore = score
+			bestPhase = p
+		}
+	}
+	return bestPhase, bestScore
+}
+
+func zscore(a []float64) []float64 {
+	if len(a) == 0 {
+		return a
+	}
+	var mean float64
+	for _, v := range a {
+		mean += v
+	}
+	mean /= float64(len(a))
+	var variance float64
+	for _, v := range a {
+		variance += (v - mean) * (v - mean)
+	}
+	sd := math.Sqrt(variance / float64(len(a)))
+	out := make([]float64, len(a))
+	if sd == 0 {
+		return out
+	}
+	for i, v := range a {
+		out[i] = (v - mean) / sd
+	}
+	return out
+}
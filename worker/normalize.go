@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Loudness range target for loudnorm; wide enough that music keeps its
+// dynamics and the second pass can stay linear
+const normalizeLRA = 11.0
+
+// loudnormStats is the JSON block loudnorm prints with print_format=json.
+// ffmpeg prints every value as a string.
+type loudnormStats struct {
+	InputI            string `json:"input_i"`
+	InputTP           string `json:"input_tp"`
+	InputLRA          string `json:"input_lra"`
+	InputThresh       string `json:"input_thresh"`
+	OutputI           string `json:"output_i"`
+	OutputTP          string `json:"output_tp"`
+	NormalizationType string `json:"normalization_type"`
+	TargetOffset      string `json:"target_offset"`
+}
+
+type normalizeResult struct {
+	InputLUFS, InputTruePeak, InputLRA float64
+	OutputLUFS, OutputTruePeak         float64
+	Type                               string // "linear", "dynamic" or "skipped"
+}
+
+// normalizeLoudness runs two-pass loudnorm: the first pass measures the
+// input, the second applies the gain using those measurements (linear when
+// the true-peak ceiling allows it). loudnorm works at 192 kHz internally, so
+// the output is resampled back to sampleRate. Input loudnorm can't measure
+// (silence gives -inf) is left alone: the result's Type is "skipped" and
+// nothing is written to out.
+func normalizeLoudness(ctx context.Context, in, out string, targetLUFS, truePeak float64, sampleRate int) (normalizeResult, error) {
+	target := fmt.Sprintf("loudnorm=I=%.1f:TP=%.1f:LRA=%.1f", targetLUFS, truePeak, normalizeLRA)
+
+	first, err := runLoudnorm(ctx, in, target+":print_format=json", "-f", "null", "-")
+	if err != nil {
+		return normalizeResult{}, fmt.Errorf("loudnorm measure: %w", err)
+	}
+	if !measured(first.InputI, first.InputTP, first.InputThresh) {
+		// The second pass rejects measured values outside its ranges
+		var res normalizeResult
+		for _, v := range []struct {
+			dst *float64
+			s   string
+		}{
+			{&res.InputLUFS, first.InputI},
+			{&res.InputTruePeak, first.InputTP},
+			{&res.InputLRA, first.InputLRA},
+		} {
+			if *v.dst, err = parseLoudnormValue(v.s); err != nil {
+				return normalizeResult{}, err
+			}
+		}
+		res.OutputLUFS, res.OutputTruePeak = res.InputLUFS, res.InputTruePeak
+		res.Type = "skipped"
+		return res, nil
+	}
+
+	second := fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=json",
+		target, first.InputI, first.InputTP, first.InputLRA, first.InputThresh, first.TargetOffset)
+	applied, err := runLoudnorm(ctx, in, second, "-ar", strconv.Itoa(sampleRate), out)
+	if err != nil {
+		return normalizeResult{}, fmt.Errorf("loudnorm apply: %w", err)
+	}
+
+	var res normalizeResult
+	for _, v := range []struct {
+		dst *float64
+		s   string
+	}{
+		{&res.InputLUFS, first.InputI},
+		{&res.InputTruePeak, first.InputTP},
+		{&res.InputLRA, first.InputLRA},
+		{&res.OutputLUFS, applied.OutputI},
+		{&res.OutputTruePeak, applied.OutputTP},
+	} {
+		if *v.dst, err = parseLoudnormValue(v.s); err != nil {
+			return normalizeResult{}, err
+		}
+	}
+	res.Type = strings.ToLower(applied.NormalizationType)
+	return res, nil
+}
+
+func runLoudnorm(ctx context.Context, in, filter string, outArgs ...string) (loudnormStats, error) {
+	args := append([]string{"-hide_banner", "-nostats", "-y", "-i", in, "-filter:a", filter}, outArgs...)
+	out, err := runFFmpeg(ctx, args...)
+	if err != nil {
+		return loudnormStats{}, err
+	}
+	// The stats are the last {...} block in the log
+	i := strings.LastIndex(out, "{")
+	j := strings.LastIndex(out, "}")
+	if i < 0 || j < i {
+		return loudnormStats{}, errors.New("loudnorm stats not found in ffmpeg output")
+	}
+	var st loudnormStats
+	if err := json.Unmarshal([]byte(out[i:j+1]), &st); err != nil {
+		return loudnormStats{}, fmt.Errorf("parse loudnorm stats: %w", err)
+	}
+	return st, nil
+}
+
+// measured reports whether loudnorm's first-pass values are all finite.
+func measured(vals ...string) bool {
+	for _, s := range vals {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseLoudnormValue(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "-inf" {
+		// digital silence; keep it finite so it fits a numeric column
+		return -120, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse loudnorm value %q: %w", s, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Relative cost of each render stage, for turning per-stage ffmpeg progress
+// into an overall fraction. Stretching dominates; normalization is two
+// passes.
+var renderStageWeights = map[string]float64{
+	"prepare":   1,
+	"stretch":   5,
+	"click":     0.5,
+	"normalize": 2,
+	"encode":    1.5,
+}
+
+// Progress is written to the job row at most this often
+const progressWriteInterval = 2 * time.Second
+
+// renderProgress tracks how far a render is and writes it, with an ETA, to
+// its row. Each stage knows how many seconds of audio its ffmpeg runs will
+// produce in all; runFFmpeg feeds it their -progress out_time. A nil
+// *renderProgress ignores everything.
+type renderProgress struct {
+	pool     *pgxpool.Pool
+	renderID string
+	started  time.Time
+	weights  map[string]float64
+	total    float64
+
+	stage      string
+	stageSec   float64 // audio seconds the stage's ffmpeg runs produce
+	base       float64 // from runs that finished
+	run        float64 // from the current run
+	doneWeight float64
+	lastWrite  time.Time
+}
+
+// newRenderProgress tracks a render that goes through the given stages.
+func newRenderProgress(pool *pgxpool.Pool, renderID string, stages ...string) *renderProgress {
+	p := &renderProgress{pool: pool, renderID: renderID, started: time.Now(), weights: map[string]float64{}}
+	for _, s := range stages {
+		p.weights[s] = renderStageWeights[s]
+		p.total += renderStageWeights[s]
+	}
+	return p
+}
+
+// begin finishes the current stage and starts the next.
+func (p *renderProgress) begin(ctx context.Context, stage string, sec float64) {
+	if p == nil {
+		return
+	}
+	if p.stage != "" {
+		p.doneWeight += p.weights[p.stage]
+	}
+	p.stage, p.stageSec, p.base, p.run = stage, sec, 0, 0
+	p.write(ctx, true)
+}
+
+// update records the running ffmpeg's output position.
+func (p *renderProgress) update(ctx context.Context, outSec float64) {
+	if p == nil {
+		return
+	}
+	p.run = outSec
+	p.write(ctx, false)
+}
+
+// runDone counts the finished ffmpeg run into its stage.
+func (p *renderProgress) runDone() {
+	if p == nil {
+		return
+	}
+	p.base += p.run
+	p.run = 0
+}
+
+func (p *renderProgress) fraction() float64 {
+	if p.total <= 0 {
+		return 0
+	}
+	f := p.doneWeight
+	if p.stageSec > 0 {
+		f += p.weights[p.stage] * clamp((p.base+p.run)/p.stageSec, 0, 1)
+	}
+	return clamp(f/p.total, 0, 1)
+}
+
+func (p *renderProgress) write(ctx context.Context, force bool) {
+	if !force && time.Since(p.lastWrite) < progressWriteInterval {
+		return
+	}
+	p.lastWrite = time.Now()
+
+	f := p.fraction()
+	// Assumes the rest goes as fast as what's done; too noisy at the start
+	var eta *int
+	if f >= 0.02 {
+		sec := int(math.Round(time.Since(p.started).Seconds() * (1 - f) / f))
+		eta = &sec
+	}
+	// Best effort: a lost update only makes progress look stale
+	_, _ = p.pool.Exec(ctx, `
+UPDATE render_jobs
+SET progress=$1, progress_stage=$2, eta_sec=$3, progress_at=now()
+WHERE id=$4 AND status='running'`, f, p.stage, eta, p.renderID)
+}
+
+type progressKey struct{}
+
+func withProgress(ctx context.Context, p *renderProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// progressFrom returns the render progress carried by ctx, or nil.
+func progressFrom(ctx context.Context) *renderProgress {
+	p, _ := ctx.Value(progressKey{}).(*renderProgress)
+	return p
+}
+
+// runFFmpeg runs ffmpeg, reporting its output position to ctx's render
+// progress if it has one, and returns ffmpeg's log (stderr).
+func runFFmpeg(ctx context.Context, args ...string) (string, error) {
+	p := progressFrom(ctx)
+	if p == nil {
+		return runCmdOutput(ctx, "ffmpeg", args...)
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("ffmpeg %v: %w", args, err)
+	}
+
+	// key=value lines; out_time_us is "N/A" until the first frame
+	sc := bufio.NewScanner(stdout)
+	for sc.Scan() {
+		v, ok := strings.CutPrefix(sc.Text(), "out_time_us=")
+		if !ok {
+			continue
+		}
+		if us, err := strconv.ParseInt(v, 10, 64); err == nil && us >= 0 {
+			p.update(ctx, float64(us)/1e6)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("ffmpeg %v: %w\n%s", args, err, stderr.String())
+	}
+	p.runDone()
+	return stderr.String(), nil
+}
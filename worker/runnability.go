@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Cadences most runners land in, steps per minute
+const (
+	runCadenceMin = 160.0
+	runCadenceMax = 185.0
+
+	tempoMapBeats = 8 // beats per local-tempo window
+)
+
+type runnabilityResult struct {
+	Score      float64            `json:"score"` // 0..100
+	Components map[string]float64 `json:"components"`
+	// Stretch factor to the nearest running cadence (via the BPM or an
+	// octave of it); 1 means no stretching needed
+	CadenceRatio float64 `json:"cadence_ratio"`
+}
+
+// scoreRunnability rates how well a track works for running: clear,
+// regular, steady beats, enough energy, and a tempo close to a running
+// cadence. Triple-meter songs are marked down since steps can't follow them.
+func scoreRunnability(samples []float32, sampleRate int, beats []float64, bpm, beatConf, energy float64, meter *meterResult) runnabilityResult {
+	strength := beatStrength(samples, sampleRate, beats)
+	stability := tempoStability(beats)
+	ratio := cadenceStretch(bpm)
+	stretch := 1 - clamp(math.Abs(ratio-1)/0.15, 0, 1)
+
+	c := map[string]float64{
+		"beat_strength": strength,
+		"regularity":    clamp(beatConf, 0, 1),
+		"stability":     stability,
+		"energy":        clamp(energy, 0, 1),
+		"stretch":       stretch,
+	}
+	score := 0.25*c["beat_strength"] + 0.2*c["regularity"] + 0.2*c["stability"] + 0.15*c["energy"] + 0.2*c["stretch"]
+
+	meterFactor := 1.0
+	if meter != nil && meter.BeatsPerBar%3 == 0 {
+		meterFactor = 0.6
+	}
+	c["meter"] = meterFactor
+
+	for k, v := range c {
+		c[k] = math.Round(v*1000) / 1000
+	}
+	return runnabilityResult{
+		Score:        math.Round(score*meterFactor*1000) / 10,
+		Components:   c,
+		CadenceRatio: math.Round(ratio*1000) / 1000,
+	}
+}
+
+// beatStrength compares the level just after each beat with the level
+// halfway to the next one: punchy, percussive beats score near 1.
+func beatStrength(samples []float32, sampleRate int, beats []float64) float64 {
+	w := int(0.05 * float64(sampleRate))
+	var sum float64
+	var n int
+	for i := 0; i+1 < len(beats); i++ {
+		on := int(beats[i] * float64(sampleRate))
+		mid := int((beats[i] + beats[i+1]) / 2 * float64(sampleRate))
+		if on < 0 || mid+w > len(samples) || mid <= on+w {
+			continue
+		}
+		sum += windowDB(samples[on:on+w]) - windowDB(samples[mid:mid+w])
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	// ~12 dB of contrast is a very clear beat
+	return clamp(sum/float64(n)/12, 0, 1)
+}
+
+// tempoStability is 1 for a rock-steady tempo map, falling towards 0 as the
+// local tempo (over tempoMapBeats-beat windows) wanders.
+func tempoStability(beats []float64) float64 {
+	local := localTempos(beats)
+	if len(local) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, v := range local {
+		mean += v
+	}
+	mean /= float64(len(local))
+	var variance float64
+	for _, v := range local {
+		variance += (v - mean) * (v - mean)
+	}
+	cv := math.Sqrt(variance/float64(len(local))) / mean
+	// 5% spread of local tempo = unstable
+	return 1 - clamp(cv/0.05, 0, 1)
+}
+
+// localTempos is the tempo map: BPM over each run of tempoMapBeats beats.
+// Windows with dropped/extra beats (far from the median) are skipped.
+func localTempos(beats []float64) []float64 {
+	var out []float64
+	for i := 0; i+tempoMapBeats < len(beats); i += tempoMapBeats / 2 {
+		span := beats[i+tempoMapBeats] - beats[i]
+		if span > 0 {
+			out = append(out, 60*tempoMapBeats/span)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), out...)
+	sort.Float64s(sorted)
+	med := median(sorted)
+	kept := out[:0]
+	for _, v := range out {
+		if math.Abs(v-med) <= med*0.15 {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// cadenceStretch returns the tempo ratio needed to bring the song (stepping
+// on every beat, every other beat, or twice per beat) into the running
+// cadence range; the smallest stretch wins.
+func cadenceStretch(bpm float64) float64 {
+	if bpm <= 0 {
+		return 0
+	}
+	best := math.Inf(1)
+	bestRatio := 1.0
+	for _, f := range []float64{1, 2, 0.5} {
+		spm := bpm * f
+		ratio := 1.0
+		switch {
+		case spm < runCadenceMin:
+			ratio = runCadenceMin / spm
+		case spm > runCadenceMax:
+			ratio = runCadenceMax / spm
+		}
+		if d := math.Abs(ratio - 1); d < best {
+			best, bestRatio = d, ratio
+		}
+	}
+	return bestRatio
+}
+
+func windowDB(x []float32) float64 {
+	var sum float64
+	for _, v := range x {
+		sum += float64(v) * float64(v)
+	}
+	return rmsDB(sum, len(x))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A renderSegment is a stretch of the source played at one tempo. A render's
+// segment plan covers the (trimmed) source end to end; constant-tempo
+// renders have a single segment.
+type renderSegment struct {
+	SrcStart  float64 `json:"src_start"`
+	SrcEnd    float64 `json:"src_end"`
+	TargetBpm float64 `json:"target_bpm"`
+	Ratio     float64 `json:"ratio"`
+	OutStart  float64 `json:"out_start"`
+	OutEnd    float64 `json:"out_end"`
+}
+
+// rampOptions is a tempo ramp render, as stored on the job.
+type rampOptions struct {
+	StartBpm float64 `json:"start_bpm"`
+	EndBpm   float64 `json:"end_bpm"`
+	Shape    string  `json:"shape"`           // "linear" or "steps"
+	Steps    int     `json:"steps,omitempty"` // for "steps"
+	// Ramp over this many output seconds, then hold EndBpm; default is the
+	// whole track
+	DurationSec *float64 `json:"duration_sec,omitempty"`
+}
+
+// intervalOptions is an interval workout render, as stored on the job: the
+// segments (output time) play in order, Repeat times over, and the last
+// tempo holds to the end of the track.
+type intervalOptions struct {
+	Segments []struct {
+		DurationSec float64 `json:"duration_sec"`
+		TargetBpm   float64 `json:"target_bpm"`
+	} `json:"segments"`
+	Repeat int `json:"repeat"`
+	// Beats over which the tempo steps from one interval's to the next's,
+	// starting on the interval boundary; 0 switches on the beat
+	TransitionBeats int `json:"transition_beats"`
+}
+
+const (
+	// Linear ramps change tempo every rampChunkBeats source beats: short
+	// enough to sound continuous, long enough to keep joins few
+	rampChunkBeats = 4
+
+	// Each side of a join renders this much extra (output seconds), and
+	// neighbours crossfade over the overlap, so joins have no click or gap
+	segmentOverlapSec = 0.025
+
+	// Plans never have more segments than this: each is a separate stretch,
+	// so long ramps and workouts get coarser tempo changes instead
+	maxRenderSegments = 128
+
+	// Segments are crossfaded together at most this many per ffmpeg run
+	// (each is an open input file)
+	segmentJoinBatch = 32
+)
+
+// constantPlan is the single segment of a fixed-tempo render.
+func constantPlan(srcStart, srcEnd, sourceBpm, targetBpm float64) []renderSegment {
+	ratio := targetBpm / sourceBpm
+	return []renderSegment{{
+		SrcStart: srcStart, SrcEnd: srcEnd,
+		TargetBpm: targetBpm, Ratio: ratio,
+		OutStart: 0, OutEnd: (srcEnd - srcStart) / ratio,
+	}}
+}
+
+// rampPlan builds segments whose target tempo follows the ramp.
+func rampPlan(r rampOptions, beats []float64, srcStart, srcEnd, sourceBpm float64) []renderSegment {
+	chunk := rampChunkBeats
+	if r.Shape == "steps" {
+		chunk = 1 // only step boundaries cut; one beat precision for where they fall
+	}
+	return planSegments(beats, srcStart, srcEnd, sourceBpm, chunk, func(outT, srcFrac float64) float64 {
+		progress := srcFrac
+		if r.DurationSec != nil && *r.DurationSec > 0 {
+			progress = outT / *r.DurationSec
+		}
+		progress = clamp(progress, 0, 1)
+		if r.Shape == "steps" && r.Steps >= 2 {
+			step := math.Min(math.Floor(progress*float64(r.Steps)), float64(r.Steps-1))
+			progress = step / float64(r.Steps-1)
+		}
+		return r.StartBpm + (r.EndBpm-r.StartBpm)*progress
+	})
+}
+
+// intervalPlan builds segments that follow the workout's intervals. Changes
+// happen on the first beat at or after each interval boundary.
+func intervalPlan(iv intervalOptions, beats []float64, srcStart, srcEnd, sourceBpm float64) []renderSegment {
+	type interval struct{ end, bpm float64 }
+	var ivs []interval
+	t := 0.0
+	for r := 0; r < max(iv.Repeat, 1); r++ {
+		for _, s := range iv.Segments {
+			t += s.DurationSec
+			ivs = append(ivs, interval{t, s.TargetBpm})
+		}
+	}
+	if len(ivs) == 0 {
+		return constantPlan(srcStart, srcEnd, sourceBpm, sourceBpm)
+	}
+
+	return planSegments(beats, srcStart, srcEnd, sourceBpm, 1, func(outT, _ float64) float64 {
+		i := 0
+		for i < len(ivs)-1 && outT >= ivs[i].end {
+			i++
+		}
+		bpm := ivs[i].bpm
+		if i == 0 || iv.TransitionBeats <= 0 || ivs[i-1].bpm == bpm {
+			return bpm
+		}
+		// Step a fraction of the way per beat into the interval
+		prev, start := ivs[i-1].bpm, ivs[i-1].end
+		k := math.Floor((outT-start)*bpm/60) + 1
+		return prev + (bpm-prev)*math.Min(k/float64(iv.TransitionBeats), 1)
+	})
+}
+
+// planSegments walks the source in chunks of chunkBeats beats and asks
+// targetAt for the tempo at each chunk's start (given the output time so far
+// and how far through the source it is). Chunks with the same tempo merge,
+// so cuts land on beats and only where the tempo changes. While that gives
+// more than maxRenderSegments segments, chunks double in length.
+func planSegments(beats []float64, srcStart, srcEnd, sourceBpm float64, chunkBeats int, targetAt func(outT, srcFrac float64) float64) []renderSegment {
+	for {
+		plan := planChunks(beats, srcStart, srcEnd, sourceBpm, chunkBeats, targetAt)
+		if len(plan) <= maxRenderSegments || chunkBeats >= len(beats) {
+			return plan
+		}
+		chunkBeats *= 2
+	}
+}
+
+func planChunks(beats []float64, srcStart, srcEnd, sourceBpm float64, chunkBeats int, targetAt func(outT, srcFrac float64) float64) []renderSegment {
+	cuts := []float64{srcStart}
+	n := 0
+	for _, b := range beats {
+		if b <= srcStart || b >= srcEnd {
+			continue
+		}
+		n++
+		if n%chunkBeats == 0 {
+			cuts = append(cuts, b)
+		}
+	}
+	cuts = append(cuts, srcEnd)
+
+	var plan []renderSegment
+	outT := 0.0
+	for i := 0; i+1 < len(cuts); i++ {
+		a, b := cuts[i], cuts[i+1]
+		bpm := targetAt(outT, (a-srcStart)/(srcEnd-srcStart))
+		ratio := bpm / sourceBpm
+		dur := (b - a) / ratio
+		if k := len(plan) - 1; k >= 0 && math.Abs(plan[k].TargetBpm-bpm) < 1e-6 {
+			plan[k].SrcEnd, plan[k].OutEnd = b, outT+dur
+		} else {
+			plan = append(plan, renderSegment{SrcStart: a, SrcEnd: b, TargetBpm: bpm, Ratio: ratio, OutStart: outT, OutEnd: outT + dur})
+		}
+		outT += dur
+	}
+	return plan
+}
+
+// mapToOutput returns where source time t lands in the render, if it's in
+// the plan at all.
+func mapToOutput(plan []renderSegment, t float64) (float64, bool) {
+	for _, s := range plan {
+		if t >= s.SrcStart && t < s.SrcEnd {
+			return s.OutStart + (t-s.SrcStart)/s.Ratio, true
+		}
+	}
+	return 0, false
+}
+
+// renderSegments stretches each segment of the plan on its own and joins
+// them with short crossfades centred on the segment boundaries. in must be
+// a WAV, so seeking into it is exact.
+func renderSegments(ctx context.Context, engine stretchEngine, in, out string, plan []renderSegment, sampleRate int, preset, tmpDir string) error {
+	if len(plan) == 1 {
+		s := plan[0]
+		return engine.Stretch(ctx, in, out, buildTrimFilter(&s.SrcStart, &s.SrcEnd), s.Ratio, sampleRate, preset)
+	}
+
+	dir := filepath.Join(tmpDir, "segments")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	segs := make([]string, len(plan))
+	for i, s := range plan {
+		start, end := s.SrcStart, s.SrcEnd
+		if i > 0 {
+			start = math.Max(0, start-segmentOverlapSec*s.Ratio)
+		}
+		if i < len(plan)-1 {
+			end += segmentOverlapSec * s.Ratio
+		}
+		// Cut with an input seek, so each segment only decodes its own part
+		src := filepath.Join(dir, fmt.Sprintf("src%03d.wav", i))
+		if err := runCmd(ctx, "ffmpeg", "-y", "-ss", formatSec(start), "-t", formatSec(end-start), "-i", in, src); err != nil {
+			return fmt.Errorf("ffmpeg segment %d cut failed: %w", i, err)
+		}
+		segs[i] = filepath.Join(dir, fmt.Sprintf("seg%03d.wav", i))
+		if err := engine.Stretch(ctx, src, segs[i], "", s.Ratio, sampleRate, preset); err != nil {
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+		_ = os.Remove(src)
+	}
+	return joinCrossfaded(ctx, segs, out, dir, 0)
+}
+
+// joinCrossfaded crossfades the files together in order, at most
+// segmentJoinBatch per ffmpeg run: longer lists are joined in batches, and
+// then the batches. A batch keeps the overlap at its ends, so joining
+// batches crossfades exactly like joining segments.
+func joinCrossfaded(ctx context.Context, files []string, out, dir string, level int) error {
+	if len(files) <= segmentJoinBatch {
+		args := []string{"-y"}
+		for _, f := range files {
+			args = append(args, "-i", f)
+		}
+		// [0][1]acrossfade[j1];[j1][2]acrossfade[j2];...
+		fade := "acrossfade=d=" + strconv.FormatFloat(2*segmentOverlapSec, 'f', 3, 64) + ":c1=tri:c2=tri"
+		var graph []string
+		prev := "[0:a]"
+		for i := 1; i < len(files); i++ {
+			label := fmt.Sprintf("[j%d]", i)
+			graph = append(graph, fmt.Sprintf("%s[%d:a]%s%s", prev, i, fade, label))
+			prev = label
+		}
+		if len(graph) == 0 {
+			graph = []string{"[0:a]anull[j0]"}
+			prev = "[j0]"
+		}
+		args = append(args, "-filter_complex", strings.Join(graph, ";"), "-map", prev, out)
+		if _, err := runFFmpeg(ctx, args...); err != nil {
+			return fmt.Errorf("ffmpeg segment join failed: %w", err)
+		}
+		return nil
+	}
+
+	var batches []string
+	for i := 0; i < len(files); i += segmentJoinBatch {
+		b := filepath.Join(dir, fmt.Sprintf("join%d_%03d.wav", level, len(batches)))
+		if err := joinCrossfaded(ctx, files[i:min(i+segmentJoinBatch, len(files))], b, dir, level+1); err != nil {
+			return err
+		}
+		batches = append(batches, b)
+	}
+	return joinCrossfaded(ctx, batches, out, dir, level+1)
+}
+
+// joinPasses is how many times joining n segments writes the whole render:
+// once per level of batching.
+func joinPasses(n int) int {
+	passes := 1
+	for n > segmentJoinBatch {
+		n = (n + segmentJoinBatch - 1) / segmentJoinBatch
+		passes++
+	}
+	return passes
+}
+
+func formatSec(sec float64) string {
+	return strconv.FormatFloat(sec, 'f', 6, 64)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	silenceNoiseDB     = -50.0 // silencedetect threshold
+	silenceMinSec      = 0.5   // shortest gap reported as silence
+	sectionFrameSec    = 1.0   // RMS frame for intro/outro detection
+	sectionSustainSec  = 4     // frames the level must hold to count as "in the song"
+	sectionBelowRefDB  = 10.0  // how far under the typical level intros/outros sit
+	sectionMaxFraction = 1.0 / 3
+)
+
+type silenceRegion struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type sectionsResult struct {
+	DurationSec   float64
+	IntroEndSec   float64 // 0 when the song starts straight away
+	OutroStartSec float64 // == DurationSec when the song ends on the beat
+	Silences      []silenceRegion
+}
+
+var (
+	silenceStartRe = regexp.MustCompile(`silence_start: (-?[\d.]+)`)
+	silenceEndRe   = regexp.MustCompile(`silence_end: (-?[\d.]+)`)
+)
+
+// detectSilences runs ffmpeg silencedetect over the original file. A
+// silence still open at EOF is closed at durationSec.
+func detectSilences(ctx context.Context, inputPath string, durationSec float64) ([]silenceRegion, error) {
+	out, err := runCmdOutput(ctx, "ffmpeg", "-hide_banner", "-nostats",
+		"-i", inputPath,
+		"-af", fmt.Sprintf("silencedetect=noise=%gdB:d=%g", silenceNoiseDB, silenceMinSec),
+		"-f", "null", "-",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg silencedetect failed: %w", err)
+	}
+
+	starts := silenceStartRe.FindAllStringSubmatch(out, -1)
+	ends := silenceEndRe.FindAllStringSubmatch(out, -1)
+
+	var regions []silenceRegion
+	for i, m := range starts {
+		start, _ := strconv.ParseFloat(m[1], 64)
+		end := durationSec
+		if i < len(ends) {
+			end, _ = strconv.ParseFloat(ends[i][1], 64)
+		}
+		regions = append(regions, silenceRegion{Start: math.Max(0, start), End: end})
+	}
+	return regions, nil
+}
+
+// detectSections finds where the song proper starts and ends: past any
+// leading/trailing silence, where the level first (last) holds near the
+// track's typical level, snapped to the nearest beat.
+func detectSections(samples []float32, sampleRate int, beats []float64, silences []silenceRegion) sectionsResult {
+	duration := float64(len(samples)) / float64(sampleRate)
+	res := sectionsResult{DurationSec: duration, OutroStartSec: duration, Silences: silences}
+
+	frame := int(sectionFrameSec * float64(sampleRate))
+	if frame <= 0 || len(samples) < frame*sectionSustainSec*2 {
+		return res
+	}
+
+	var levels []float64
+	for start := 0; start+frame <= len(samples); start += frame {
+		var sum float64
+		for _, x := range samples[start : start+frame] {
+			sum += float64(x) * float64(x)
+		}
+		levels = append(levels, rmsDB(sum, frame))
+	}
+
+	// Typical level: median of the frames that aren't silent
+	var audible []float64
+	for _, l := range levels {
+		if l > silenceNoiseDB {
+			audible = append(audible, l)
+		}
+	}
+	if len(audible) == 0 {
+		return res
+	}
+	sort.Float64s(audible)
+	threshold := median(audible) - sectionBelowRefDB
+
+	sustained := func(i int) bool {
+		if i < 0 || i+sectionSustainSec > len(levels) {
+			return false
+		}
+		for _, l := range levels[i : i+sectionSustainSec] {
+			if l < threshold {
+				return false
+			}
+		}
+		return true
+	}
+
+	introEnd := 0.0
+	for i := range levels {
+		if sustained(i) {
+			introEnd = float64(i) * sectionFrameSec
+			break
+		}
+	}
+	outroStart := duration
+	for i := len(levels) - sectionSustainSec; i >= 0; i-- {
+		if sustained(i) {
+			outroStart = float64(i+sectionSustainSec) * sectionFrameSec
+			break
+		}
+	}
+
+	// Never start inside leading silence or end inside trailing silence
+	for _, sr := range silences {
+		if sr.Start <= 0.05 && sr.End > introEnd {
+			introEnd = sr.End
+		}
+		if sr.End >= duration-0.05 && sr.Start < outroStart {
+			outroStart = sr.Start
+		}
+	}
+
+	introEnd = snapToBeat(beats, introEnd)
+	outroStart = snapToBeat(beats, outroStart)
+
+	// Anything longer isn't an intro/outro, it's the song being quiet
+	if introEnd <= duration*sectionMaxFraction {
+		res.IntroEndSec = introEnd
+	}
+	if outroStart >= duration*(1-sectionMaxFraction) && outroStart > res.IntroEndSec {
+		res.OutroStartSec = math.Min(outroStart, duration)
+	}
+	return res
+}
+
+// snapToBeat moves t onto the nearest beat when one is within a second.
+func snapToBeat(beats []float64, t float64) float64 {
+	i := sort.SearchFloat64s(beats, t)
+	best, bestDist := t, 1.0
+	for _, j := range []int{i - 1, i} {
+		if j >= 0 && j < len(beats) {
+			if d := math.Abs(beats[j] - t); d < bestDist {
+				best, bestDist = beats[j], d
+			}
+		}
+	}
+	return best
+}
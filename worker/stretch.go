@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/stretch"
+)
+
+// A stretchEngine changes the tempo of a WAV file by ratio (>1 is faster),
+// applying pre (an ffmpeg filter, e.g. the trim) on the source timeline first.
+type stretchEngine interface {
+	Name() string
+	Available(ctx context.Context) bool
+	Stretch(ctx context.Context, in, out, pre string, ratio float64, sampleRate int, preset string) error
+}
+
+var stretchEngines = map[string]stretchEngine{
+	stretch.Atempo:     atempoEngine{},
+	stretch.Rubberband: &rubberbandEngine{},
+	stretch.Resample:   resampleEngine{},
+}
+
+// pickStretchEngine returns the requested engine, or atempo when it can't
+// run here (e.g. no Rubber Band in this image). The preset falls back to the
+// engine's default along with it.
+func pickStretchEngine(ctx context.Context, name, preset string) (stretchEngine, string) {
+	eng, ok := stretchEngines[name]
+	if !ok || !eng.Available(ctx) {
+		log.Printf("stretch engine %q not available, falling back to %s\n", name, stretch.Atempo)
+		return stretchEngines[stretch.Atempo], stretch.DefaultPreset(stretch.Atempo)
+	}
+	if preset == "" || !stretch.Valid(name, preset) {
+		preset = stretch.DefaultPreset(name)
+	}
+	return eng, preset
+}
+
+// runFilterStretch is the common path for engines that are ffmpeg filters.
+func runFilterStretch(ctx context.Context, in, out, pre, filter string) error {
+	chain := filter
+	if pre != "" {
+		chain = pre + "," + filter
+	}
+	if _, err := runFFmpeg(ctx, "-y", "-i", in, "-filter:a", chain, out); err != nil {
+		return fmt.Errorf("ffmpeg stretch failed: %w", err)
+	}
+	return nil
+}
+
+type atempoEngine struct{}
+
+func (atempoEngine) Name() string                       { return stretch.Atempo }
+func (atempoEngine) Available(ctx context.Context) bool { return true }
+
+func (atempoEngine) Stretch(ctx context.Context, in, out, pre string, ratio float64, sampleRate int, preset string) error {
+	chain, err := buildAtempoChain(ratio)
+	if err != nil {
+		return err
+	}
+	return runFilterStretch(ctx, in, out, pre, chain)
+}
+
+type resampleEngine struct{}
+
+func (resampleEngine) Name() string                       { return stretch.Resample }
+func (resampleEngine) Available(ctx context.Context) bool { return true }
+
+func (resampleEngine) Stretch(ctx context.Context, in, out, pre string, ratio float64, sampleRate int, preset string) error {
+	chain, err := buildResampleFilter(ratio, sampleRate)
+	if err != nil {
+		return err
+	}
+	if preset == "high" {
+		chain += ":resampler=soxr"
+	}
+	return runFilterStretch(ctx, in, out, pre, chain)
+}
+
+// buildResampleFilter speeds audio up by ratio by reinterpreting its sample
+// rate, then resamples back to sampleRate ("vinyl" mode).
+func buildResampleFilter(ratio float64, sampleRate int) (string, error) {
+	if ratio <= 0 {
+		return "", fmt.Errorf("invalid ratio: %v", ratio)
+	}
+	return fmt.Sprintf("asetrate=%d,aresample=%d", int(math.Round(float64(sampleRate)*ratio)), sampleRate), nil
+}
+
+// rubberbandEngine prefers ffmpeg's rubberband filter (one pass) and falls
+// back to the rubberband CLI when ffmpeg was built without librubberband.
+type rubberbandEngine struct {
+	once      sync.Once
+	hasFilter bool
+	hasCLI    bool
+}
+
+// Filter options per preset; "balanced" is the library defaults
+var rubberbandFilterPresets = map[string]string{
+	"balanced":   "",
+	"fast":       ":window=short:pitchq=speed",
+	"high":       ":transients=mixed:detector=compound:smoothing=on:channels=together:pitchq=quality",
+	"percussive": ":transients=crisp:detector=percussive:window=short",
+}
+
+// CLI flags per preset: -2 is the faster R2 engine (-c sets its
+// crispness), -3 the finer R3 engine
+var rubberbandCLIPresets = map[string][]string{
+	"balanced":   {"-2"},
+	"fast":       {"-2", "-c", "3"},
+	"high":       {"-3"},
+	"percussive": {"-2", "-c", "6"},
+}
+
+func (e *rubberbandEngine) Name() string { return stretch.Rubberband }
+
+func (e *rubberbandEngine) Available(ctx context.Context) bool {
+	e.once.Do(func() {
+		if out, err := runCmdOutput(ctx, "ffmpeg", "-hide_banner", "-filters"); err == nil {
+			for _, line := range strings.Split(out, "\n") {
+				if f := strings.Fields(line); len(f) >= 2 && f[1] == "rubberband" {
+					e.hasFilter = true
+				}
+			}
+		}
+		_, err := exec.LookPath("rubberband")
+		e.hasCLI = err == nil
+	})
+	return e.hasFilter || e.hasCLI
+}
+
+func (e *rubberbandEngine) Stretch(ctx context.Context, in, out, pre string, ratio float64, sampleRate int, preset string) error {
+	if ratio <= 0 {
+		return fmt.Errorf("invalid ratio: %v", ratio)
+	}
+	if e.hasFilter {
+		return runFilterStretch(ctx, in, out, pre, "rubberband=tempo="+strconv.FormatFloat(ratio, 'f', 6, 64)+rubberbandFilterPresets[preset])
+	}
+
+	// CLI: apply pre with ffmpeg first, then stretch file to file
+	src := in
+	if pre != "" {
+		src = filepath.Join(filepath.Dir(out), "prestretch.wav")
+		if _, err := runFFmpeg(ctx, "-y", "-i", in, "-filter:a", pre, src); err != nil {
+			return fmt.Errorf("ffmpeg prestretch failed: %w", err)
+		}
+	}
+	args := append([]string{"-q", "--tempo", strconv.FormatFloat(ratio, 'f', 6, 64)}, rubberbandCLIPresets[preset]...)
+	if err := runCmd(ctx, "rubberband", append(args, src, out)...); err != nil {
+		return fmt.Errorf("rubberband failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// readWavMono loads a PCM WAV file (as written by ffmpeg) and returns its
+// samples downmixed to mono in [-1, 1].
+func readWavMono(path string) ([]float32, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 1<<16)
+
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, 0, fmt.Errorf("read wav header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, 0, errors.New("not a RIFF/WAVE file")
+	}
+
+	var (
+		format        uint16
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		haveFmt       bool
+	)
+
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, 0, fmt.Errorf("wav data chunk not found: %w", err)
+		}
+		id := string(hdr[0:4])
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+
+		switch id {
+		case "fmt ":
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, 0, fmt.Errorf("read fmt chunk: %w", err)
+			}
+			if len(buf) < 16 {
+				return nil, 0, errors.New("short fmt chunk")
+			}
+			format = binary.LittleEndian.Uint16(buf[0:2])
+			channels = int(binary.LittleEndian.Uint16(buf[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(buf[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(buf[14:16]))
+			if format == 0xFFFE && len(buf) >= 26 {
+				// WAVE_FORMAT_EXTENSIBLE: real format is the first two bytes of the subformat GUID
+				format = binary.LittleEndian.Uint16(buf[24:26])
+			}
+			haveFmt = true
+			if size%2 == 1 {
+				_, _ = r.ReadByte()
+			}
+
+		case "data":
+			if !haveFmt {
+				return nil, 0, errors.New("wav data before fmt chunk")
+			}
+			samples, err := decodePCM(r, size, format, channels, bitsPerSample)
+			if err != nil {
+				return nil, 0, err
+			}
+			return samples, sampleRate, nil
+
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, 0, fmt.Errorf("skip %q chunk: %w", id, err)
+			}
+		}
+	}
+}
+
+func decodePCM(r io.Reader, size int64, format uint16, channels, bits int) ([]float32, error) {
+	if channels <= 0 {
+		return nil, errors.New("wav has no channels")
+	}
+	bytesPerSample := bits / 8
+	switch {
+	case format == 1 && (bits == 16 || bits == 24 || bits == 32):
+	case format == 3 && bits == 32:
+	default:
+		return nil, fmt.Errorf("unsupported wav encoding (format=%d bits=%d)", format, bits)
+	}
+
+	frameSize := bytesPerSample * channels
+	// ffmpeg writes a bogus size when the output isn't seekable; read to EOF then
+	if size <= 0 || size == math.MaxUint32 {
+		size = math.MaxInt64
+	}
+
+	var out []float32
+	if size != math.MaxInt64 {
+		out = make([]float32, 0, size/int64(frameSize))
+	}
+
+	frame := make([]byte, frameSize)
+	for read := int64(0); read+int64(frameSize) <= size; read += int64(frameSize) {
+		if _, err := io.ReadFull(r, frame); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		var sum float64
+		for c := 0; c < channels; c++ {
+			b := frame[c*bytesPerSample : (c+1)*bytesPerSample]
+			sum += pcmSample(b, format, bits)
+		}
+		out = append(out, float32(sum/float64(channels)))
+	}
+	return out, nil
+}
+
+func pcmSample(b []byte, format uint16, bits int) float64 {
+	switch {
+	case format == 3:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case bits == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768.0
+	case bits == 24:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / 8388608.0
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648.0
+	}
+}
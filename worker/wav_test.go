@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/JGrinovich/bpm-runner-app/shared/audiofixture"
+	"github.com/JGrinovich/bpm-runner-app/shared/tempo"
+)
+
+func TestReadWavMonoFixture(t *testing.T) {
+	clip, err := audiofixture.Generate(audiofixture.Spec{SampleRate: 48000, Channels: 2, BPM: 120, Duration: 3, Pan: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "fixture.wav")
+	if err := clip.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, sr, err := readWavMono(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr != 48000 {
+		t.Errorf("sample rate %d, want 48000", sr)
+	}
+	if len(samples) != len(clip.Samples[0]) {
+		t.Fatalf("%d samples, want %d", len(samples), len(clip.Samples[0]))
+	}
+	// Clicks are panned hard left/right alternately, so the downmix has
+	// every one of them
+	frame := int(clip.Beats[1] * 48000)
+	var peak float64
+	for _, v := range samples[frame : frame+480] {
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if peak < 0.2 {
+		t.Errorf("click at %.2fs missing from the downmix (peak %v)", clip.Beats[1], peak)
+	}
+}
+
+func TestAubioBeatTimesFixture(t *testing.T) {
+	if _, err := exec.LookPath("aubio"); err != nil {
+		t.Skip("aubio not installed")
+	}
+	clip, err := audiofixture.ClickTrack(128, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "fixture.wav")
+	if err := clip.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	beats, err := aubioBeatTimes(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bpm, _, ok := tempo.BPMAndConfidenceFromBeats(beats)
+	if !ok || math.Abs(bpm-128) > 2 {
+		t.Errorf("aubio tempo %v (ok=%v), want 128", bpm, ok)
+	}
+}
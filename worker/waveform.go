@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/JGrinovich/bpm-runner-app/worker/internal/storage"
+)
+
+// Zoom levels for the player's waveform, in source samples per pixel. The
+// coarsest fits a whole track on screen, the finest is for zooming in.
+var waveformLevels = []int{8192, 2048, 512}
+
+// waveform is multi-resolution peak data in the spirit of audiowaveform's
+// JSON output: each level holds interleaved min,max pairs as 8-bit values.
+type waveform struct {
+	Version     int             `json:"version"`
+	SampleRate  int             `json:"sample_rate"`
+	Channels    int             `json:"channels"`
+	Bits        int             `json:"bits"`
+	DurationSec float64         `json:"duration_sec"`
+	Levels      []waveformLevel `json:"levels"`
+}
+
+type waveformLevel struct {
+	SamplesPerPixel int    `json:"samples_per_pixel"`
+	Length          int    `json:"length"`
+	Data            []int8 `json:"data"`
+}
+
+func buildWaveform(samples []float32, sampleRate int) waveform {
+	wf := waveform{
+		Version:     1,
+		SampleRate:  sampleRate,
+		Channels:    1,
+		Bits:        8,
+		DurationSec: float64(len(samples)) / float64(sampleRate),
+	}
+	for _, spp := range waveformLevels {
+		n := (len(samples) + spp - 1) / spp
+		lvl := waveformLevel{SamplesPerPixel: spp, Length: n, Data: make([]int8, 0, 2*n)}
+		for i := 0; i < n; i++ {
+			end := min((i+1)*spp, len(samples))
+			lo, hi := float32(0), float32(0)
+			for _, v := range samples[i*spp : end] {
+				lo = min(lo, v)
+				hi = max(hi, v)
+			}
+			lvl.Data = append(lvl.Data, peakToInt8(lo), peakToInt8(hi))
+		}
+		wf.Levels = append(wf.Levels, lvl)
+	}
+	return wf
+}
+
+func peakToInt8(v float32) int8 {
+	return int8(math.Round(clamp(float64(v), -1, 1) * 127))
+}
+
+// uploadWaveform writes the peaks as JSON next to the audio in storage.
+func uploadWaveform(ctx context.Context, r2c *storage.R2Client, key string, wf waveform, tmpDir string) error {
+	b, err := json.Marshal(wf)
+	if err != nil {
+		return err
+	}
+	local := filepath.Join(tmpDir, "waveform.json")
+	if err := os.WriteFile(local, b, 0o644); err != nil {
+		return err
+	}
+	return r2c.UploadFromFile(ctx, key, local, "application/json")
+}
+
+// fileWaveform decodes any audio file ffmpeg understands to mono and
+// builds its peaks; used for renders, whose output is already encoded.
+func fileWaveform(ctx context.Context, audioPath, tmpDir string) (waveform, error) {
+	wav := filepath.Join(tmpDir, "peaks.wav")
+	if err := runCmd(ctx, "ffmpeg", "-y", "-i", audioPath, "-ac", "1", "-ar", "44100", wav); err != nil {
+		return waveform{}, fmt.Errorf("ffmpeg waveform decode failed: %w", err)
+	}
+	samples, sampleRate, err := readWavMono(wav)
+	if err != nil {
+		return waveform{}, fmt.Errorf("read wav failed: %w", err)
+	}
+	return buildWaveform(samples, sampleRate), nil
+}
+
+// Each analysis run gets its own key, so a run that fails or is canceled
+// never replaces the waveform the track points at. A run that finishes
+// deletes the previous run's.
+func analysisWaveformKey(analysisID string) string {
+	return "waveforms/analyses/" + analysisID + ".json"
+}
+func renderWaveformKey(renderID string) string { return "waveforms/renders/" + renderID + ".json" }